@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver for places.sqlite
+)
+
+// BookmarkConfig is the JSON form of the bookmark settings in config.json
+type BookmarkConfig struct {
+	FolderSubdirectories bool `json:"folder_subdirectories"` // mirror bookmark folders as download subfolders
+}
+
+// bookmarkOptions is the active bookmark configuration, set at startup
+var bookmarkOptions BookmarkConfig
+
+// chromiumRoots are the top-level folders of a Chromium Bookmarks file, in
+// the order the browser shows them
+var chromiumRoots = []string{"bookmark_bar", "other", "synced"}
+
+// chromiumBookmark is a node of a Chromium Bookmarks file
+type chromiumBookmark struct {
+	Type     string             `json:"type"` // "url" or "folder"
+	Name     string             `json:"name"`
+	URL      string             `json:"url"`
+	Children []chromiumBookmark `json:"children"`
+}
+
+// chromiumBookmarksExtractor reads the Bookmarks JSON file of Chrome, Edge,
+// Brave and other Chromium-based browsers
+type chromiumBookmarksExtractor struct{}
+
+func (chromiumBookmarksExtractor) Name() string         { return "chromium-bookmarks" }
+func (chromiumBookmarksExtractor) Extensions() []string { return nil }
+func (chromiumBookmarksExtractor) FileNames() []string  { return []string{"bookmarks"} }
+func (chromiumBookmarksExtractor) MIMETypes() []string  { return nil }
+
+func (chromiumBookmarksExtractor) Extract(r io.Reader) ([]Link, error) {
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid bookmarks file: %w", err)
+	}
+
+	// Known roots first, then any others a newer browser may add
+	names := append([]string{}, chromiumRoots...)
+	var others []string
+	for name := range file.Roots {
+		if !slices.Contains(chromiumRoots, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	var links linkSet
+	for _, name := range names {
+		raw, ok := file.Roots[name]
+		if !ok {
+			continue
+		}
+		var root chromiumBookmark
+		if err := json.Unmarshal(raw, &root); err != nil || root.Type != "folder" {
+			continue
+		}
+		addChromiumBookmarks(&links, root, []string{root.Name})
+	}
+
+	return links.links, nil
+}
+
+// addChromiumBookmarks adds the bookmarks in folder and its subfolders
+func addChromiumBookmarks(links *linkSet, folder chromiumBookmark, path []string) {
+	for _, node := range folder.Children {
+		switch node.Type {
+		case "url":
+			links.addLink(Link{URL: node.URL, Text: node.Name, Folder: path})
+		case "folder":
+			addChromiumBookmarks(links, node, append(path[:len(path):len(path)], node.Name))
+		}
+	}
+}
+
+// firefoxRootTitles names Firefox's built-in bookmark folders, keyed by GUID
+var firefoxRootTitles = map[string]string{
+	"menu________": "Bookmarks Menu",
+	"toolbar_____": "Bookmarks Toolbar",
+	"unfiled_____": "Other Bookmarks",
+	"mobile______": "Mobile Bookmarks",
+}
+
+// firefoxTagsGUID is the folder holding Firefox tags, which repeat bookmarks
+const firefoxTagsGUID = "tags________"
+
+// firefoxPlacesExtractor reads Firefox's places.sqlite database. The
+// database is copied first, so a running browser's lock does not matter.
+type firefoxPlacesExtractor struct{}
+
+func (firefoxPlacesExtractor) Name() string         { return "firefox-places" }
+func (firefoxPlacesExtractor) Extensions() []string { return nil }
+func (firefoxPlacesExtractor) FileNames() []string  { return []string{"places.sqlite"} }
+func (firefoxPlacesExtractor) MIMETypes() []string  { return nil }
+
+func (e firefoxPlacesExtractor) Extract(r io.Reader) ([]Link, error) {
+	return e.extractCopy(func(dbPath string) error {
+		return writeFileFrom(dbPath, r)
+	})
+}
+
+// ExtractFile copies the database together with its write-ahead log, which
+// holds recent changes while Firefox is running
+func (e firefoxPlacesExtractor) ExtractFile(filePath string) ([]Link, error) {
+	return e.extractCopy(func(dbPath string) error {
+		if err := copyFile(filePath, dbPath); err != nil {
+			return err
+		}
+		if err := copyFile(filePath+"-wal", dbPath+"-wal"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// extractCopy creates a copy of the database with write in a temporary
+// directory and reads the bookmarks from it
+func (firefoxPlacesExtractor) extractCopy(write func(dbPath string) error) ([]Link, error) {
+	dir, err := os.MkdirTemp("", "places-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "places.sqlite")
+	if err := write(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	return readFirefoxBookmarks(db)
+}
+
+// firefoxBookmark is a row of moz_bookmarks joined with its URL
+type firefoxBookmark struct {
+	id, parent, kind int64
+	title, guid, url string
+}
+
+// readFirefoxBookmarks walks the bookmark tree from the root, in the order
+// Firefox shows it, skipping tags
+func readFirefoxBookmarks(db *sql.DB) ([]Link, error) {
+	rows, err := db.Query(`
+		SELECT b.id, b.parent, b.type, COALESCE(b.title, ''), COALESCE(b.guid, ''), COALESCE(p.url, '')
+		FROM moz_bookmarks b LEFT JOIN moz_places p ON p.id = b.fk
+		ORDER BY b.parent, b.position`)
+	if err != nil {
+		return nil, fmt.Errorf("not a Firefox places database: %w", err)
+	}
+	defer rows.Close()
+
+	children := make(map[int64][]firefoxBookmark)
+	for rows.Next() {
+		var b firefoxBookmark
+		if err := rows.Scan(&b.id, &b.parent, &b.kind, &b.title, &b.guid, &b.url); err != nil {
+			return nil, fmt.Errorf("failed to read bookmarks: %w", err)
+		}
+		children[b.parent] = append(children[b.parent], b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bookmarks: %w", err)
+	}
+
+	// moz_bookmarks types: 1 = bookmark, 2 = folder, 3 = separator
+	var links linkSet
+	var walk func(parent int64, path []string)
+	walk = func(parent int64, path []string) {
+		for _, b := range children[parent] {
+			switch b.kind {
+			case 1:
+				links.addLink(Link{URL: b.url, Text: b.title, Folder: path})
+			case 2:
+				if b.guid == firefoxTagsGUID {
+					continue
+				}
+				title := b.title
+				if rootTitle, ok := firefoxRootTitles[b.guid]; ok {
+					title = rootTitle
+				}
+				walk(b.id, append(path[:len(path):len(path)], title))
+			}
+		}
+	}
+
+	// The root folder is the only entry without a parent
+	for _, root := range children[0] {
+		walk(root.id, nil)
+	}
+
+	return links.links, nil
+}
+
+// bookmarkDir returns the directory a link should be downloaded to: dir
+// itself, or with bookmarks.folder_subdirectories the link's folder path
+// below dir, created if needed
+func bookmarkDir(dir string, link Link) (string, error) {
+	if !bookmarkOptions.FolderSubdirectories || len(link.Folder) == 0 {
+		return dir, nil
+	}
+
+	target := dir
+	for _, folder := range link.Folder {
+		name := sanitizeFilename(folder)
+		if name == "" || name == "." || name == ".." {
+			continue
+		}
+		target = filepath.Join(target, name)
+	}
+	if !isWithinDir(target, dir) {
+		return "", fmt.Errorf("bookmark folder %q is outside %s", filepath.Join(link.Folder...), dir)
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", fmt.Errorf("failed to create bookmark folder: %w", err)
+	}
+	return target, nil
+}
+
+// copyFile copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileFrom(dst, in)
+}
+
+// writeFileFrom creates path with the content of r
+func writeFileFrom(path string, r io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// hashFile returns the hex SHA-256 of a file's contents
+func hashFile(file *os.File) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, 1<<62)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verifyDigest compares a hex SHA-256 against the digest announced by the
+// server in Repr-Digest (RFC 9530) or Digest (RFC 3230), if any
+func verifyDigest(resp *http.Response, sha256Hex string) error {
+	if resp.Uncompressed {
+		// The announced digest describes the encoded bytes
+		return nil
+	}
+
+	expected := announcedSHA256(resp.Header)
+	if expected == "" {
+		return nil
+	}
+	if !strings.EqualFold(expected, sha256Hex) {
+		return fmt.Errorf("SHA-256 mismatch: server announced %s, got %s", expected, sha256Hex)
+	}
+	return nil
+}
+
+// announcedSHA256 extracts a hex SHA-256 from Repr-Digest or Digest headers
+func announcedSHA256(header http.Header) string {
+	// Repr-Digest: sha-256=:<base64>:
+	for _, field := range strings.Split(header.Get("Repr-Digest"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if ok && strings.EqualFold(name, "sha-256") {
+			if decoded, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":")); err == nil {
+				return hex.EncodeToString(decoded)
+			}
+		}
+	}
+
+	// Digest: SHA-256=<base64>
+	for _, field := range strings.Split(header.Get("Digest"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if ok && strings.EqualFold(name, "sha-256") {
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				return hex.EncodeToString(decoded)
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieConfig is the JSON form of the cookie settings in config.json
+type CookieConfig struct {
+	File     string `json:"file"`      // Netscape cookies.txt to load
+	Save     bool   `json:"save"`      // write cookies back when the run ends
+	SaveFile string `json:"save_file"` // destination for saving (default: File)
+}
+
+// storedCookie is one cookie in the jar, with the attributes needed to
+// scope it and to write it back in Netscape format
+type storedCookie struct {
+	Domain   string // lowercase, without leading dot
+	HostOnly bool   // sent only to Domain itself, not its subdomains
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	Expires  time.Time // zero for session cookies
+	Name     string
+	Value    string
+}
+
+// cookieJar is an http.CookieJar that can be loaded from and saved to
+// Netscape cookies.txt files. Cookies are only returned for the hosts and
+// paths they are scoped to.
+type cookieJar struct {
+	mu      sync.Mutex
+	cookies map[string]*storedCookie // keyed by domain, path and name
+}
+
+// newCookieJar returns an empty jar
+func newCookieJar() *cookieJar {
+	return &cookieJar{cookies: make(map[string]*storedCookie)}
+}
+
+func cookieKey(domain, path, name string) string {
+	return domain + ";" + path + ";" + name
+}
+
+// loadNetscapeFile adds the cookies from a Netscape cookies.txt file
+func (j *cookieJar) loadNetscapeFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	loaded := 0
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// HttpOnly cookies are written as comments with a special prefix
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line = rest
+			httpOnly = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return loaded, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", lineNum, len(fields))
+		}
+
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return loaded, fmt.Errorf("line %d: invalid expiry %q", lineNum, fields[4])
+		}
+
+		domain := strings.ToLower(fields[0])
+		cookie := &storedCookie{
+			Domain:   strings.TrimPrefix(domain, "."),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE") && !strings.HasPrefix(domain, "."),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HTTPOnly: httpOnly,
+			Name:     fields[5],
+			Value:    strings.Join(fields[6:], "\t"),
+		}
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+			if cookie.Expires.Before(time.Now()) {
+				continue
+			}
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+
+		j.cookies[cookieKey(cookie.Domain, cookie.Path, cookie.Name)] = cookie
+		loaded++
+	}
+
+	return loaded, scanner.Err()
+}
+
+// saveNetscapeFile writes all unexpired cookies in Netscape format, replacing
+// the file atomically
+func (j *cookieJar) saveNetscapeFile(path string) error {
+	j.mu.Lock()
+	cookies := make([]*storedCookie, 0, len(j.cookies))
+	now := time.Now()
+	for _, cookie := range j.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			cookies = append(cookies, cookie)
+		}
+	}
+	j.mu.Unlock()
+
+	sort.Slice(cookies, func(a, b int) bool {
+		return cookieKey(cookies[a].Domain, cookies[a].Path, cookies[a].Name) <
+			cookieKey(cookies[b].Domain, cookies[b].Path, cookies[b].Name)
+	})
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".cookies-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	w := bufio.NewWriter(tmpFile)
+	fmt.Fprintf(w, "# Netscape HTTP Cookie File\n")
+	fmt.Fprintf(w, "# Written by ArchiveDownloader. Edit at your own risk.\n\n")
+	for _, cookie := range cookies {
+		domain := cookie.Domain
+		includeSubdomains := "FALSE"
+		if !cookie.HostOnly {
+			domain = "." + domain
+			includeSubdomains = "TRUE"
+		}
+		if cookie.HTTPOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expiry int64
+		if !cookie.Expires.IsZero() {
+			expiry = cookie.Expires.Unix()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, includeSubdomains, cookie.Path,
+			netscapeBool(cookie.Secure), expiry, cookie.Name, cookie.Value)
+	}
+
+	if err := w.Flush(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// SetCookies implements http.CookieJar. Cookies whose Domain attribute does
+// not cover the responding host, or that name a public suffix, are ignored.
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalCookieHost(u)
+	if host == "" {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		cookie := &storedCookie{
+			Domain:   host,
+			HostOnly: true,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+			Name:     c.Name,
+			Value:    c.Value,
+		}
+
+		if c.Domain != "" {
+			domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+			if !domainMatch(host, domain) || isPublicSuffix(domain) {
+				continue
+			}
+			cookie.Domain = domain
+			cookie.HostOnly = false
+		}
+
+		if cookie.Path == "" || !strings.HasPrefix(cookie.Path, "/") {
+			cookie.Path = defaultCookiePath(u.Path)
+		}
+
+		key := cookieKey(cookie.Domain, cookie.Path, cookie.Name)
+		switch {
+		case c.MaxAge < 0:
+			delete(j.cookies, key)
+			continue
+		case c.MaxAge > 0:
+			cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			if !c.Expires.After(now) {
+				delete(j.cookies, key)
+				continue
+			}
+			cookie.Expires = c.Expires
+		}
+
+		j.cookies[key] = cookie
+	}
+}
+
+// Cookies implements http.CookieJar
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalCookieHost(u)
+	if host == "" {
+		return nil
+	}
+	secure := u.Scheme == "https"
+	requestPath := u.Path
+	if requestPath == "" {
+		requestPath = "/"
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var matched []*storedCookie
+	for key, cookie := range j.cookies {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		if cookie.Secure && !secure {
+			continue
+		}
+		if cookie.HostOnly && host != cookie.Domain {
+			continue
+		}
+		if !cookie.HostOnly && !domainMatch(host, cookie.Domain) {
+			continue
+		}
+		if !pathMatch(requestPath, cookie.Path) {
+			continue
+		}
+		matched = append(matched, cookie)
+	}
+
+	// Longer paths first, as browsers do
+	sort.Slice(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+
+	result := make([]*http.Cookie, 0, len(matched))
+	for _, cookie := range matched {
+		result = append(result, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return result
+}
+
+// canonicalCookieHost returns the lowercase host of u without port
+func canonicalCookieHost(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// domainMatch reports whether host is domain or a subdomain of it.
+// IP addresses only match exactly.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	return strings.HasSuffix(host, "."+domain)
+}
+
+// isPublicSuffix reports whether domain is a public suffix such as "com" or
+// "co.uk", for which cookies must not be accepted
+func isPublicSuffix(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return false
+	}
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+// pathMatch implements the RFC 6265 path-match rule
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath implements the RFC 6265 default-path rule
+func defaultCookiePath(requestPath string) string {
+	if requestPath == "" || requestPath[0] != '/' {
+		return "/"
+	}
+	idx := strings.LastIndex(requestPath, "/")
+	if idx == 0 {
+		return "/"
+	}
+	return requestPath[:idx]
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// diskFree is not implemented on this platform; the free-space check is skipped
+func diskFree(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the bytes available to the current user on the volume
+// containing dir
+func diskFree(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &freeBytes, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(freeBytes), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// errQuotaExhausted is reported for downloads not started because the
+// per-run download quota has been used up
+var errQuotaExhausted = errors.New("download quota exhausted")
+
+// errQuotaExceeded is reported for downloads whose announced size, or whose
+// body while streaming, would take the run past its download quota
+var errQuotaExceeded = errors.New("download quota exceeded")
+
+// freeSpaceCheckInterval is how many bytes a download may write beyond its
+// announced size between free space checks
+const freeSpaceCheckInterval = 8 << 20
+
+// DiskGuard checks free disk space and enforces the per-run download quota
+type DiskGuard struct {
+	Reserve int64 // bytes that must remain free after each download
+	Quota   int64 // total bytes allowed per run (0 = unlimited)
+
+	used    atomic.Int64 // bytes written plus bytes reserved by in-flight downloads
+	pending atomic.Int64 // announced bytes that in-flight downloads have not written yet
+	mu      sync.Mutex   // serialises free space checks with new reservations
+}
+
+// diskGuard is the active guard, configured from config.json and flags at startup
+var diskGuard = &DiskGuard{}
+
+// diskReservation is the share of the quota and free disk space held by one
+// in-flight download
+type diskReservation struct {
+	guard   *DiskGuard
+	dir     string
+	quota   int64 // bytes counted against the quota
+	pending int64 // announced bytes not written yet
+	written int64
+	unsized int64 // bytes written beyond the announced size since the last free space check
+}
+
+// quotaExhausted reports whether the quota has been used up
+func (g *DiskGuard) quotaExhausted() bool {
+	return g.Quota > 0 && g.used.Load() >= g.Quota
+}
+
+// usedBytes returns the number of bytes counted against the quota so far
+func (g *DiskGuard) usedBytes() int64 {
+	return g.used.Load()
+}
+
+// acquire checks that a download of size bytes (-1 if unknown) fits on the
+// filesystem containing dir, next to the downloads already in flight, and
+// within the quota. The reservation must be released when the download ends.
+func (g *DiskGuard) acquire(dir string, size int64) (*diskReservation, error) {
+	announced := max(size, 0)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Check free space on the target filesystem, less what in-flight
+	// downloads are still going to write
+	if err := g.checkFree(dir, announced); err != nil {
+		return nil, err
+	}
+
+	r := &diskReservation{guard: g, dir: dir}
+	if g.Quota > 0 {
+		// Reserve the announced size against the quota
+		for {
+			used := g.used.Load()
+			if used >= g.Quota {
+				return nil, errQuotaExhausted
+			}
+			if used+announced > g.Quota {
+				return nil, fmt.Errorf("%w: size %s exceeds remaining %s",
+					errQuotaExceeded, formatBytes(announced), formatBytes(g.Quota-used))
+			}
+			if g.used.CompareAndSwap(used, used+announced) {
+				r.quota = announced
+				break
+			}
+		}
+	}
+
+	r.pending = announced
+	g.pending.Add(announced)
+	return r, nil
+}
+
+// checkFree fails if writing size more bytes to dir would leave less than the
+// reserve free once in-flight downloads finish. Filesystems whose free space
+// cannot be read are not checked.
+func (g *DiskGuard) checkFree(dir string, size int64) error {
+	free, err := diskFree(dir)
+	if err != nil {
+		return nil
+	}
+	inFlight := g.pending.Load()
+	needed := g.Reserve + size + inFlight
+	if free < needed {
+		return fmt.Errorf("insufficient disk space: %s free, %s needed (including %s reserve and %s for downloads in progress)",
+			formatBytes(free), formatBytes(needed), formatBytes(g.Reserve), formatBytes(inFlight))
+	}
+	return nil
+}
+
+// add counts n written bytes against the reservation. Bytes beyond the
+// announced size are charged to the quota as they arrive, and free space is
+// rechecked every freeSpaceCheckInterval bytes.
+func (r *diskReservation) add(n int64) error {
+	g := r.guard
+	r.written += n
+
+	settled := min(n, r.pending)
+	r.pending -= settled
+	g.pending.Add(-settled)
+
+	if extra := r.written - r.quota; g.Quota > 0 && extra > 0 {
+		for {
+			used := g.used.Load()
+			if used+extra > g.Quota {
+				return errQuotaExceeded
+			}
+			if g.used.CompareAndSwap(used, used+extra) {
+				r.quota += extra
+				break
+			}
+		}
+	}
+
+	r.unsized += n - settled
+	if r.unsized >= freeSpaceCheckInterval {
+		r.unsized = 0
+		return g.checkFree(r.dir, 0)
+	}
+	return nil
+}
+
+// release replaces the reservation with the number of bytes actually kept on disk
+func (r *diskReservation) release(written int64) {
+	g := r.guard
+	g.pending.Add(-r.pending)
+	r.pending = 0
+	if g.Quota > 0 {
+		g.used.Add(written - r.quota)
+		r.quota = written
+	}
+}
+
+// writer returns w wrapped to count each write against the reservation
+func (r *diskReservation) writer(w io.Writer) io.Writer {
+	return &reservedWriter{w: w, reservation: r}
+}
+
+// reservedWriter fails once a write would exceed the quota or the free space
+// reserve
+type reservedWriter struct {
+	w           io.Writer
+	reservation *diskReservation
+}
+
+func (rw *reservedWriter) Write(p []byte) (int, error) {
+	if err := rw.reservation.add(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return rw.w.Write(p)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Default size limits for document formats, which are parsed in memory
+const (
+	defaultPDFMaxSize      = 100 << 20
+	defaultDocumentMaxSize = 50 << 20
+)
+
+// pdfExtractor reads URI link annotations and page text from PDF files
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string          { return "pdf" }
+func (pdfExtractor) Extensions() []string  { return []string{".pdf"} }
+func (pdfExtractor) MIMETypes() []string   { return []string{"application/pdf"} }
+func (pdfExtractor) DefaultMaxSize() int64 { return defaultPDFMaxSize }
+
+func (e pdfExtractor) Extract(r io.Reader) (links []Link, err error) {
+	content, err := readDocument(r, e)
+	if err != nil {
+		return nil, err
+	}
+
+	// The PDF reader reports malformed files by panicking
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			links, err = nil, fmt.Errorf("invalid PDF: %v", recovered)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PDF: %w", err)
+	}
+
+	var set linkSet
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		// Link annotations with a URI action
+		annots := page.V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			annot := annots.Index(j)
+			action := annot.Key("A")
+			if annot.Key("Subtype").Name() == "Link" && action.Key("S").Name() == "URI" {
+				set.add(action.Key("URI").RawString(), "")
+			}
+		}
+
+		// Plain URLs in the page text; pages whose text cannot be decoded
+		// still contribute their annotations
+		if text, err := page.GetPlainText(nil); err == nil {
+			set.addText(text)
+		}
+	}
+
+	return set.links, nil
+}
+
+// docxHyperlinkPattern matches HYPERLINK field codes in Word documents
+var docxHyperlinkPattern = regexp.MustCompile(`HYPERLINK\s+"([^"]+)"`)
+
+// docxExtractor reads hyperlinks and plain URLs from Word documents
+type docxExtractor struct{}
+
+func (docxExtractor) Name() string         { return "docx" }
+func (docxExtractor) Extensions() []string { return []string{".docx"} }
+func (docxExtractor) MIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+}
+func (docxExtractor) DefaultMaxSize() int64 { return defaultDocumentMaxSize }
+
+func (e docxExtractor) Extract(r io.Reader) ([]Link, error) {
+	archive, err := openDocumentZip(r, e)
+	if err != nil {
+		return nil, err
+	}
+	limit := extractors.maxSize(e)
+
+	var links linkSet
+	for _, file := range archive.File {
+		// The body, headers, footers, footnotes and comments are separate
+		// parts, each with its own relationships
+		dir, name := path.Split(file.Name)
+		if dir != "word/" || path.Ext(name) != ".xml" {
+			continue
+		}
+
+		targets, err := readDocxHyperlinks(archive, "word/_rels/"+name+".rels", limit)
+		if err != nil {
+			return nil, err
+		}
+		part, err := readZipFile(file, limit)
+		if err != nil {
+			return nil, err
+		}
+		if err := addDocxPartLinks(&links, part, targets); err != nil {
+			return nil, fmt.Errorf("invalid document %s: %w", file.Name, err)
+		}
+	}
+
+	return links.links, nil
+}
+
+// readDocxHyperlinks returns the external hyperlink targets of a part's
+// relationships file by relationship ID
+func readDocxHyperlinks(archive *zip.Reader, relsName string, limit int64) (map[string]string, error) {
+	targets := make(map[string]string)
+
+	file := findZipFile(archive, relsName)
+	if file == nil {
+		return targets, nil
+	}
+	content, err := readZipFile(file, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID         string `xml:"Id,attr"`
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(content, &rels); err != nil {
+		return nil, fmt.Errorf("invalid relationships %s: %w", relsName, err)
+	}
+	for _, rel := range rels.Relationships {
+		if strings.HasSuffix(rel.Type, "/hyperlink") && rel.TargetMode == "External" {
+			targets[rel.ID] = rel.Target
+		}
+	}
+	return targets, nil
+}
+
+// addDocxPartLinks adds the hyperlinks of a WordprocessingML part, with
+// their text, followed by the plain URLs in its text
+func addDocxPartLinks(links *linkSet, part []byte, targets map[string]string) error {
+	var text, linkText strings.Builder
+	var linkID string
+	inText, inInstr := false, false
+
+	decoder := xml.NewDecoder(bytes.NewReader(part))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "hyperlink":
+				linkID = xmlAttr(t, "id")
+				linkText.Reset()
+			case "t":
+				inText = true
+			case "instrText":
+				inInstr = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "hyperlink":
+				if target, ok := targets[linkID]; ok {
+					links.add(target, strings.TrimSpace(linkText.String()))
+				}
+				linkID = ""
+			case "t":
+				inText = false
+			case "instrText":
+				inInstr = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+				if linkID != "" {
+					linkText.Write(t)
+				}
+			}
+			if inInstr {
+				if match := docxHyperlinkPattern.FindSubmatch(t); match != nil {
+					links.add(string(match[1]), "")
+				}
+			}
+		}
+	}
+
+	links.addText(text.String())
+	return nil
+}
+
+// openDocumentExtractor reads links from OpenDocument text, spreadsheet and
+// presentation files
+type openDocumentExtractor struct{}
+
+func (openDocumentExtractor) Name() string         { return "opendocument" }
+func (openDocumentExtractor) Extensions() []string { return []string{".odt", ".ods", ".odp"} }
+func (openDocumentExtractor) MIMETypes() []string {
+	return []string{
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation",
+	}
+}
+func (openDocumentExtractor) DefaultMaxSize() int64 { return defaultDocumentMaxSize }
+
+func (e openDocumentExtractor) Extract(r io.Reader) ([]Link, error) {
+	archive, err := openDocumentZip(r, e)
+	if err != nil {
+		return nil, err
+	}
+
+	file := findZipFile(archive, "content.xml")
+	if file == nil {
+		return nil, fmt.Errorf("invalid OpenDocument file: no content.xml")
+	}
+	content, err := readZipFile(file, extractors.maxSize(e))
+	if err != nil {
+		return nil, err
+	}
+
+	// Links are <text:a xlink:href="...">; paragraphs and headings end lines
+	var links linkSet
+	var text, linkText strings.Builder
+	var href string
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenDocument content: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "a" {
+				href = xmlAttr(t, "href")
+				linkText.Reset()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "a":
+				links.add(href, strings.TrimSpace(linkText.String()))
+				href = ""
+			case "p", "h":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			text.Write(t)
+			if href != "" {
+				linkText.Write(t)
+			}
+		}
+	}
+
+	links.addText(text.String())
+	return links.links, nil
+}
+
+// epubExtractor reads the links in the XHTML content of EPUB books
+type epubExtractor struct{}
+
+func (epubExtractor) Name() string          { return "epub" }
+func (epubExtractor) Extensions() []string  { return []string{".epub"} }
+func (epubExtractor) MIMETypes() []string   { return []string{"application/epub+zip"} }
+func (epubExtractor) DefaultMaxSize() int64 { return defaultDocumentMaxSize }
+
+func (e epubExtractor) Extract(r io.Reader) ([]Link, error) {
+	archive, err := openDocumentZip(r, e)
+	if err != nil {
+		return nil, err
+	}
+	limit := extractors.maxSize(e)
+
+	// Links between chapters are relative and dropped; only absolute
+	// links leave the book
+	var links linkSet
+	for _, file := range archive.File {
+		switch strings.ToLower(path.Ext(file.Name)) {
+		case ".xhtml", ".html", ".htm":
+		default:
+			continue
+		}
+
+		content, err := readZipFile(file, limit)
+		if err != nil {
+			return nil, err
+		}
+		urls, err := parseHTMLLinks(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid chapter %s: %w", file.Name, err)
+		}
+		for _, url := range urls {
+			links.add(url, "")
+		}
+	}
+
+	return links.links, nil
+}
+
+// openDocumentZip reads a ZIP-based document within the extractor's size limit
+func openDocumentZip(r io.Reader, e Extractor) (*zip.Reader, error) {
+	content, err := readDocument(r, e)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file: %w", e.Name(), err)
+	}
+	return archive, nil
+}
+
+// findZipFile returns the archive entry with the given name, or nil
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// readZipFile decompresses an archive entry, refusing entries larger than
+// limit (unless 0) so a small, highly compressed file cannot exhaust memory
+func readZipFile(file *zip.File, limit int64) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	if limit <= 0 {
+		return io.ReadAll(rc)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is larger than %s when decompressed", file.Name, formatBytes(limit))
+	}
+	return content, nil
+}
+
+// xmlAttr returns the value of the attribute with the given local name, or ""
+func xmlAttr(element xml.StartElement, local string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
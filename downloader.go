@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,40 +18,76 @@ import (
 	"time"
 )
 
-// HTTPClient is the shared HTTP client with timeout
-var HTTPClient = &http.Client{
-	Timeout: 5 * time.Minute,
-}
-
 // GitHub URL patterns for matching
 var (
 	githubRepoPattern = regexp.MustCompile(`^https?://github\.com/([a-zA-Z0-9_-]+)/([a-zA-Z0-9_.-]+)`)
 )
 
+// preserveModTime sets downloaded files' modification times from the server
+// instead of the time of download
+var preserveModTime = true
+
+// githubToken is the GitHub token from config or $GITHUB_TOKEN, if any.
+// With a token, archives are fetched through the API so private repositories
+// work and the authenticated rate limit applies.
+var githubToken string
+
 // DownloadResult represents the result of a download attempt
 type DownloadResult struct {
-	URL         string
-	FilePath    string
-	Success     bool
-	Skipped     bool
-	Error       error
+	URL          string
+	FilePath     string
+	Success      bool
+	Skipped      bool
+	Filtered     bool
+	FilterReason string
+	Error        error
 	BytesWritten int64
+
+	SHA256        string   // hex SHA-256 of the downloaded file
+	FinalURL      string   // URL the content was served from
+	RedirectChain []string // every URL visited, original first, when redirected
+
+	StatusCode   int       // HTTP status of the response that was saved
+	ETag         string    // ETag of the saved response, if any
+	ContentType  string    // Content-Type of the saved response, if any
+	DownloadedAt time.Time // when the download completed
+	LastModified time.Time // server's Last-Modified, or the commit date of a GitHub archive
+	ModTimeError error     // why LastModified could not be set as the file's modification time
+
+	RecoveredFromArchive bool      // the link was dead; content came from the Wayback Machine
+	ArchiveURL           string    // snapshot URL the content was recovered from
+	ArchiveTimestamp     time.Time // when the snapshot was captured
 }
 
-// downloadURL downloads a file from a URL to a target directory
-func downloadURL(downloadURL, targetDir string) DownloadResult {
+// downloadURL downloads a link to a target directory, naming the file with
+// the filename template if one is set. Cancelling ctx aborts the transfer
+// and removes the partial file.
+func downloadURL(ctx context.Context, link Link, targetDir string, filter DownloadFilter) DownloadResult {
+	downloadURL := link.URL
 	result := DownloadResult{
 		URL: downloadURL,
 	}
 
+	// Don't start new downloads after an interrupt
+	if markInterrupted(ctx, &result) {
+		return result
+	}
+
+	// Stop starting new downloads once the run's quota is used up
+	if diskGuard.quotaExhausted() {
+		result.Skipped = true
+		result.Error = errQuotaExhausted
+		return result
+	}
+
 	// Check if this is a GitHub URL and handle it specially
 	if isGitHubRepoURL(downloadURL) {
 		// Extract owner and repo from URL
 		owner, repo := extractGitHubInfo(downloadURL)
 		if owner != "" && repo != "" {
 			// Generate filename for GitHub repo
-			filename := fmt.Sprintf("%s-%s.zip", owner, repo)
-			filePath := filepath.Join(targetDir, filename)
+			filePath := linkFilePath(targetDir, fmt.Sprintf("%s-%s.zip", owner, repo), link)
+			filename := filepath.Base(filePath)
 			result.FilePath = filePath
 
 			// Check if file already exists - skip if it does
@@ -56,61 +97,97 @@ func downloadURL(downloadURL, targetDir string) DownloadResult {
 				return result
 			}
 
-			// Try to download from main, master, and HEAD branches
-			branches := []string{"main", "master", "HEAD"}
-			var lastErr error
+			// Apply extension filters to the archive name
+			if reason := filter.checkName(filename); reason != "" {
+				result.Filtered = true
+				result.FilterReason = reason
+				return result
+			}
 
-			for _, branch := range branches {
-				var archiveURL string
+			// Try to download from main, master, and HEAD branches, preceded by
+			// the API zipball of the default branch when a token is available
+			type githubArchive struct{ url, ref string }
+			var archives []githubArchive
+			if githubToken != "" {
+				archives = append(archives, githubArchive{fmt.Sprintf("https://api.github.com/repos/%s/%s/zipball", owner, repo), "HEAD"})
+			}
+			for _, branch := range []string{"main", "master", "HEAD"} {
 				if branch == "HEAD" {
-					archiveURL = fmt.Sprintf("https://github.com/%s/%s/archive/HEAD.zip", owner, repo)
+					archives = append(archives, githubArchive{fmt.Sprintf("https://github.com/%s/%s/archive/HEAD.zip", owner, repo), branch})
 				} else {
-					archiveURL = fmt.Sprintf("https://github.com/%s/%s/archive/refs/heads/%s.zip", owner, repo, branch)
+					archives = append(archives, githubArchive{fmt.Sprintf("https://github.com/%s/%s/archive/refs/heads/%s.zip", owner, repo, branch), branch})
 				}
+			}
+			var lastErr error
+			dead := true
+
+			for _, archive := range archives {
 
 				// Try to download from this branch
-				resp, err := HTTPClient.Get(archiveURL)
+				resp, err := httpGet(ctx, archive.url)
 				if err != nil {
+					if markInterrupted(ctx, &result) {
+						return result
+					}
 					lastErr = err
+					dead = dead && isDeadLink(nil, err)
 					continue
 				}
-				defer resp.Body.Close()
+				recordRedirects(resp, &result)
 
 				// Check if successful
 				if resp.StatusCode == http.StatusOK {
-					// Create output file
-					outFile, err := os.Create(filePath)
-					if err != nil {
-						result.Error = fmt.Errorf("failed to create file: %w", err)
-						return result
+					saveResponse(ctx, resp, filePath, filter, &result)
+					resp.Body.Close()
+
+					// Archives have no Last-Modified; date them by their commit.
+					// Without a token each lookup would eat into the API's
+					// small unauthenticated rate limit, so it is skipped.
+					if result.Success && preserveModTime && githubToken != "" {
+						if commitDate, err := githubCommitDate(ctx, owner, repo, archive.ref); err == nil {
+							result.LastModified = commitDate
+							result.ModTimeError = setModTime(filePath, commitDate)
+						}
 					}
-
-					// Copy response body to file
-					bytesWritten, err := io.Copy(outFile, resp.Body)
-					outFile.Close()
-
-					if err != nil {
-						// Clean up partial file on error
-						os.Remove(filePath)
-						result.Error = fmt.Errorf("failed to write file: %w", err)
-						return result
-					}
-
-					// Success
-					result.Success = true
-					result.BytesWritten = bytesWritten
 					return result
 				}
+				resp.Body.Close()
 				lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+				dead = dead && isDeadLink(resp, nil)
 			}
 
 			// All branches failed
 			result.Error = fmt.Errorf("failed to download GitHub repo from all branches: %w", lastErr)
+
+			// A deleted repository is gone on every branch; fall back to an
+			// archived copy of one of its branch archives
+			if wayback.enabled && dead {
+				failed := result
+				for _, archive := range archives {
+					if strings.HasPrefix(archive.url, "https://api.github.com/") {
+						continue
+					}
+					result = failed
+					if markInterrupted(ctx, &result) {
+						break
+					}
+					if recoverFromWayback(ctx, archive.url, filePath, filter, &result) || result.Filtered || result.Skipped {
+						break
+					}
+				}
+			}
 			return result
 		}
 	}
 
 	// Not a GitHub repo URL or failed to parse - proceed with normal download
+	// Apply extension filters before making any request
+	if reason := filter.checkURL(downloadURL); reason != "" {
+		result.Filtered = true
+		result.FilterReason = reason
+		return result
+	}
+
 	// Generate filename from URL
 	filename, err := getFilenameFromURL(downloadURL)
 	if err != nil {
@@ -119,7 +196,8 @@ func downloadURL(downloadURL, targetDir string) DownloadResult {
 	}
 
 	// Create full file path
-	filePath := filepath.Join(targetDir, filename)
+	filePath := linkFilePath(targetDir, filename, link)
+	filename = filepath.Base(filePath)
 	result.FilePath = filePath
 
 	// Check if file already exists
@@ -130,24 +208,37 @@ func downloadURL(downloadURL, targetDir string) DownloadResult {
 	}
 
 	// Make HTTP request
-	resp, err := HTTPClient.Get(downloadURL)
+	resp, err := httpGet(ctx, downloadURL)
 	if err != nil {
+		if markInterrupted(ctx, &result) {
+			return result
+		}
 		result.Error = fmt.Errorf("HTTP request failed: %w", err)
+		// Fall back to an archived copy if the host no longer resolves
+		if wayback.enabled && isDeadLink(nil, err) {
+			recoverFromWayback(ctx, downloadURL, filePath, filter, &result)
+		}
 		return result
 	}
 	defer resp.Body.Close()
+	recordRedirects(resp, &result)
 
 	// Check HTTP status code
 	if resp.StatusCode != http.StatusOK {
 		result.Error = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		// Fall back to an archived copy if the page is gone
+		if wayback.enabled && isDeadLink(resp, nil) {
+			resp.Body.Close()
+			recoverFromWayback(ctx, downloadURL, filePath, filter, &result)
+		}
 		return result
 	}
 
 	// Try to get filename from Content-Disposition header
 	if contentDisposition := resp.Header.Get("Content-Disposition"); contentDisposition != "" {
 		if cdFilename := parseContentDisposition(contentDisposition); cdFilename != "" {
-			filename = cdFilename
-			filePath = filepath.Join(targetDir, filename)
+			filePath = linkFilePath(targetDir, cdFilename, link)
+			filename = filepath.Base(filePath)
 			result.FilePath = filePath
 
 			// Check again if file exists with new filename
@@ -159,28 +250,135 @@ func downloadURL(downloadURL, targetDir string) DownloadResult {
 		}
 	}
 
+	// Apply extension filters to the final filename
+	if reason := filter.checkName(filename); reason != "" {
+		result.Filtered = true
+		result.FilterReason = reason
+		return result
+	}
+
+	saveResponse(ctx, resp, filePath, filter, &result)
+	return result
+}
+
+// saveResponse writes a successful response body to filePath, applying the
+// filter's header checks and size limit, and records the outcome in result
+func saveResponse(ctx context.Context, resp *http.Response, filePath string, filter DownloadFilter, result *DownloadResult) {
+	// Check size and content type from the response headers before writing
+	if reason := filter.checkResponse(resp); reason != "" {
+		result.Filtered = true
+		result.FilterReason = reason
+		return
+	}
+
+	// Check free disk space and the download quota
+	reservation, err := diskGuard.acquire(filepath.Dir(filePath), resp.ContentLength)
+	if err != nil {
+		if errors.Is(err, errQuotaExhausted) || errors.Is(err, errQuotaExceeded) {
+			result.Skipped = true
+		}
+		result.Error = err
+		return
+	}
+
 	// Create output file
 	outFile, err := os.Create(filePath)
 	if err != nil {
+		reservation.release(0)
 		result.Error = fmt.Errorf("failed to create file: %w", err)
-		return result
+		return
 	}
 
-	// Copy response body to file
-	bytesWritten, err := io.Copy(outFile, resp.Body)
+	// Copy response body to file, in parallel segments for large files on
+	// servers that support ranges, otherwise as a single stream that enforces
+	// the size limit, quota and free space reserve when the server did not
+	// announce a Content-Length
+	var bytesWritten int64
+	var sha256Hex string
+	connections := segmentation.acquire(resp)
+	if connections > 1 {
+		bytesWritten, err = downloadSegments(ctx, resp, outFile, connections)
+		if err == nil {
+			sha256Hex, err = hashFile(outFile)
+		}
+	} else {
+		hasher := sha256.New()
+		bytesWritten, err = io.Copy(&limitedWriter{w: reservation.writer(io.MultiWriter(outFile, hasher)), limit: filter.MaxSize}, resp.Body)
+		sha256Hex = hex.EncodeToString(hasher.Sum(nil))
+	}
+	segmentation.release(resp, connections)
 	outFile.Close()
 
+	// Verify the content against a digest announced by the server
+	if err == nil {
+		err = verifyDigest(resp, sha256Hex)
+	}
+
 	if err != nil {
 		// Clean up partial file on error
 		os.Remove(filePath)
+		reservation.release(0)
+		if markInterrupted(ctx, result) {
+			return
+		}
+		if errors.Is(err, errQuotaExceeded) {
+			result.Skipped = true
+			result.Error = err
+			return
+		}
+		if errors.Is(err, errSizeLimit) {
+			result.Filtered = true
+			result.FilterReason = fmt.Sprintf("size exceeds limit %s", formatBytes(filter.MaxSize))
+			return
+		}
 		result.Error = fmt.Errorf("failed to write file: %w", err)
-		return result
+		return
 	}
 
 	// Success
+	reservation.release(bytesWritten)
 	result.Success = true
 	result.BytesWritten = bytesWritten
-	return result
+	result.SHA256 = sha256Hex
+	result.StatusCode = resp.StatusCode
+	result.ETag = resp.Header.Get("ETag")
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.DownloadedAt = time.Now().UTC()
+
+	// Keep the server's modification time so files sort by their real age
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		result.LastModified = lastModified
+		if preserveModTime {
+			result.ModTimeError = setModTime(filePath, lastModified)
+		}
+	}
+}
+
+// setModTime sets the modification time of a downloaded file, leaving its
+// access time alone. A failure leaves the download time and is reported as
+// a warning.
+func setModTime(filePath string, modTime time.Time) error {
+	return os.Chtimes(filePath, time.Time{}, modTime)
+}
+
+// httpGet issues a GET request bound to ctx using the shared client
+func httpGet(ctx context.Context, urlStr string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return HTTPClient.Do(req)
+}
+
+// markInterrupted records a download aborted by cancellation as skipped,
+// returning true if ctx was cancelled
+func markInterrupted(ctx context.Context, result *DownloadResult) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	result.Skipped = true
+	result.Error = context.Cause(ctx)
+	return true
 }
 
 // isGitHubRepoURL checks if a URL points to a GitHub repository
@@ -214,6 +412,41 @@ func extractGitHubInfo(urlStr string) (owner, repo string) {
 	return owner, repo
 }
 
+// githubCommitDate returns the committer date of ref in a GitHub repository
+func githubCommitDate(ctx context.Context, owner, repo, ref string) (time.Time, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s", owner, repo, url.PathEscape(ref))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	var commit struct {
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil {
+		return time.Time{}, err
+	}
+	if commit.Commit.Committer.Date.IsZero() {
+		return time.Time{}, fmt.Errorf("commit %s has no date", ref)
+	}
+	return commit.Commit.Committer.Date, nil
+}
+
 // getFilenameFromURL extracts a filename from a URL
 func getFilenameFromURL(urlStr string) (string, error) {
 	parsedURL, err := url.Parse(urlStr)
@@ -228,8 +461,12 @@ func getFilenameFromURL(urlStr string) (string, error) {
 	if filename == "" || filename == "/" || filename == "." {
 		// Use domain name as base
 		filename = fmt.Sprintf("download_%s", parsedURL.Host)
-		// Sanitize the filename
-		filename = sanitizeFilename(filename)
+	}
+
+	// Sanitize the filename for the active filename profile
+	filename = sanitizeFilename(filename)
+	if filename == "" {
+		filename = fmt.Sprintf("download_%s", sanitizeFilename(parsedURL.Host))
 	}
 
 	// If still no extension, add .bin
@@ -274,28 +511,6 @@ func parseContentDisposition(header string) string {
 	return ""
 }
 
-// sanitizeFilename removes or replaces invalid characters in filenames
-func sanitizeFilename(filename string) string {
-	// Replace invalid Windows filename characters
-	invalid := []string{"<", ">", ":", "\"", "/", "\\", "|", "?", "*"}
-	for _, char := range invalid {
-		filename = strings.ReplaceAll(filename, char, "_")
-	}
-
-	// Remove leading/trailing spaces and dots
-	filename = strings.TrimSpace(filename)
-	filename = strings.Trim(filename, ".")
-
-	// Limit filename length (Windows has 260 char path limit)
-	if len(filename) > 200 {
-		ext := filepath.Ext(filename)
-		base := filename[:200-len(ext)]
-		filename = base + ext
-	}
-
-	return filename
-}
-
 // formatBytes formats byte count as human-readable string
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -310,4 +525,4 @@ func formatBytes(bytes int64) string {
 	}
 
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
\ No newline at end of file
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// EmailConfig is the JSON form of the email settings in config.json
+type EmailConfig struct {
+	AttachmentLinks bool `json:"attachment_links"` // read links from attachments other extractors handle, e.g. .url files
+}
+
+// emailOptions is the active email configuration, set at startup
+var emailOptions EmailConfig
+
+// maxEmailDepth bounds how deeply multipart bodies and forwarded messages
+// are followed
+const maxEmailDepth = 20
+
+// headerDecoder decodes RFC 2047 encoded words such as =?UTF-8?Q?...?= in
+// any charset the HTML decoder knows
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// nestedEmailExtractor is implemented by the email extractors so that
+// messages attached to messages keep counting towards maxEmailDepth
+type nestedEmailExtractor interface {
+	extractAtDepth(r io.Reader, depth int) ([]Link, error)
+}
+
+// emlExtractor reads a single saved email message
+type emlExtractor struct{}
+
+func (emlExtractor) Name() string         { return "eml" }
+func (emlExtractor) Extensions() []string { return []string{".eml"} }
+func (emlExtractor) MIMETypes() []string  { return []string{"message/rfc822"} }
+
+func (e emlExtractor) Extract(r io.Reader) ([]Link, error) {
+	return e.extractAtDepth(r, 0)
+}
+
+func (emlExtractor) extractAtDepth(r io.Reader, depth int) ([]Link, error) {
+	var links linkSet
+	if err := addEmailLinks(&links, r, depth); err != nil {
+		return nil, err
+	}
+	return links.links, nil
+}
+
+// mboxExtractor reads mailboxes of messages separated by "From " lines
+type mboxExtractor struct{}
+
+func (mboxExtractor) Name() string         { return "mbox" }
+func (mboxExtractor) Extensions() []string { return []string{".mbox"} }
+func (mboxExtractor) MIMETypes() []string  { return []string{"application/mbox"} }
+
+func (m mboxExtractor) Extract(r io.Reader) ([]Link, error) {
+	return m.extractAtDepth(r, 0)
+}
+
+func (mboxExtractor) extractAtDepth(r io.Reader, depth int) ([]Link, error) {
+	var links linkSet
+	var message bytes.Buffer
+	count := 0
+
+	// A broken message is reported only if no message could be read
+	var firstErr error
+	flush := func() {
+		if message.Len() == 0 {
+			return
+		}
+		if err := addEmailLinks(&links, &message, depth); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("message %d: %w", count, err)
+		}
+		message.Reset()
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte("From ")):
+				flush()
+				count++
+			case isEscapedFromLine(line):
+				// mboxrd quotes "From " lines in bodies with ">"
+				message.Write(line[1:])
+			default:
+				message.Write(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading file: %w", err)
+		}
+	}
+	flush()
+
+	if count == 0 {
+		return nil, fmt.Errorf("invalid mailbox: no \"From \" separator line")
+	}
+	if len(links.links) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return links.links, nil
+}
+
+// isEscapedFromLine reports whether line is a body line of the form
+// ">From ", ">>From ", ...
+func isEscapedFromLine(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, ">")
+	return len(trimmed) < len(line) && bytes.HasPrefix(trimmed, []byte("From "))
+}
+
+// addEmailLinks adds the links in the body of the message in r, tagged with
+// its subject
+func addEmailLinks(links *linkSet, r io.Reader, depth int) error {
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+
+	subject := message.Header.Get("Subject")
+	if decoded, err := headerDecoder.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	subject = strings.TrimSpace(subject)
+
+	return addMIMEPartLinks(links, textproto.MIMEHeader(message.Header), message.Body, subject, depth)
+}
+
+// addMIMEPartLinks adds the links in a MIME part: URLs in text and HTML
+// bodies, the parts of multipart bodies, forwarded messages and, with
+// email.attachment_links, attachments another extractor handles
+func addMIMEPartLinks(links *linkSet, header textproto.MIMEHeader, body io.Reader, subject string, depth int) error {
+	if depth > maxEmailDepth {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid multipart body: %w", err)
+			}
+			if err := addMIMEPartLinks(links, part.Header, part, subject, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if mediaType == "message/rfc822" {
+		return addEmailLinks(links, body, depth+1)
+	}
+
+	if filename, ok := attachmentName(header); ok {
+		if emailOptions.AttachmentLinks {
+			addAttachmentLinks(links, filename, mediaType, body, subject, depth)
+		}
+		return nil
+	}
+
+	switch mediaType {
+	case "text/plain":
+		content, err := io.ReadAll(decodeCharset(params["charset"], body))
+		if err != nil {
+			return fmt.Errorf("failed to read text part: %w", err)
+		}
+		for _, url := range findURLs(string(content)) {
+			links.addLink(Link{URL: url, Subject: subject})
+		}
+	case "text/html":
+		urls, err := parseHTMLLinks(decodeCharset(params["charset"], body))
+		if err != nil {
+			return fmt.Errorf("failed to read HTML part: %w", err)
+		}
+		for _, url := range urls {
+			links.addLink(Link{URL: url, Subject: subject})
+		}
+	}
+	return nil
+}
+
+// attachmentName returns the file name of an attachment, or false for inline
+// parts. Parts with a file name count as attachments even without a
+// Content-Disposition header.
+func attachmentName(header textproto.MIMEHeader) (string, bool) {
+	disposition, params, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := params["filename"]
+	if filename == "" {
+		if _, typeParams, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+			filename = typeParams["name"]
+		}
+	}
+	if decoded, err := headerDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	return filename, disposition == "attachment" || filename != ""
+}
+
+// addAttachmentLinks adds the links in an attachment that a registered
+// extractor handles, by file name or media type. Unreadable attachments are
+// skipped so they do not hide the links in the message itself. Attached
+// messages and mailboxes are read one level below depth.
+func addAttachmentLinks(links *linkSet, filename, mediaType string, body io.Reader, subject string, depth int) {
+	extractor := extractors.forPath(filename)
+	if extractor == nil {
+		extractor = extractors.forMIMEType(mediaType)
+	}
+	if extractor == nil {
+		return
+	}
+
+	var found []Link
+	var err error
+	if nested, ok := extractor.(nestedEmailExtractor); ok {
+		found, err = nested.extractAtDepth(body, depth+1)
+	} else {
+		found, err = extractor.Extract(body)
+	}
+	if err != nil {
+		return
+	}
+	for _, link := range found {
+		if link.Subject == "" {
+			link.Subject = subject
+		}
+		links.addLink(link)
+	}
+}
+
+// decodeTransferEncoding undoes a quoted-printable or base64
+// Content-Transfer-Encoding; other encodings are already plain bytes. The
+// base64 decoder skips the line breaks mailers insert.
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+// decodeCharset converts a text part to UTF-8, leaving it unchanged if the
+// charset is missing or unknown
+func decodeCharset(label string, body io.Reader) io.Reader {
+	if label == "" || strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "us-ascii") {
+		return body
+	}
+	decoded, err := charset.NewReaderLabel(label, body)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// attachedMessageChain returns a message that carries, levels deep, .eml
+// attachments of further messages; the innermost one holds a link
+func attachedMessageChain(levels int) string {
+	message := "Subject: innermost\r\n\r\nhttps://a.test/deep.zip\r\n"
+	for i := range levels {
+		boundary := fmt.Sprintf("level%d", i)
+		message = fmt.Sprintf("Subject: level %d\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n"+
+			"--%s\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"forward.eml\"\r\n\r\n"+
+			"%s\r\n--%s--\r\n", i, boundary, boundary, message, boundary)
+	}
+	return message
+}
+
+func TestEmailAttachedMessageDepth(t *testing.T) {
+	saved := emailOptions
+	defer func() { emailOptions = saved }()
+	emailOptions.AttachmentLinks = true
+
+	tests := []struct {
+		levels int
+		want   int
+	}{
+		{0, 1},
+		{3, 1},
+		{maxEmailDepth, 0},
+	}
+
+	for _, tt := range tests {
+		links, err := emlExtractor{}.Extract(strings.NewReader(attachedMessageChain(tt.levels)))
+		if err != nil {
+			t.Fatalf("%d levels: %v", tt.levels, err)
+		}
+		if len(links) != tt.want {
+			t.Errorf("%d levels: got %d links, want %d", tt.levels, len(links), tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Extractor finds the links in files of one format
+type Extractor interface {
+	// Name identifies the extractor in config.json, e.g. "markdown"
+	Name() string
+	// Extensions lists the file extensions handled, lower case with the dot
+	Extensions() []string
+	// MIMETypes lists the media types handled, e.g. for email attachments
+	MIMETypes() []string
+	// Extract returns the valid, de-duplicated links in r
+	Extract(r io.Reader) ([]Link, error)
+}
+
+// fileNameExtractor is implemented by extractors for files recognised by
+// their exact name, such as Chromium's extensionless "Bookmarks"
+type fileNameExtractor interface {
+	// FileNames lists the handled file names, lower case
+	FileNames() []string
+}
+
+// fileExtractor is implemented by extractors that need the file itself
+// rather than a stream of its content, e.g. to open a database
+type fileExtractor interface {
+	ExtractFile(filePath string) ([]Link, error)
+}
+
+// sizeLimitedExtractor is implemented by extractors that read whole files
+// into memory and refuse files above a size limit
+type sizeLimitedExtractor interface {
+	DefaultMaxSize() int64
+}
+
+// optInExtractor is implemented by extractors for formats that mostly hold
+// data other than links, such as JSON. Their files are ignored until the
+// extractor is configured to pick out the links.
+type optInExtractor interface {
+	Enabled() bool
+}
+
+// ExtractorConfig is the JSON form of the extractor settings in config.json
+type ExtractorConfig struct {
+	Extensions map[string]string `json:"extensions"` // extra extension -> extractor name, e.g. ".mdx": "markdown"
+	MaxSizes   map[string]string `json:"max_sizes"`  // extractor name -> largest file to read, e.g. "pdf": "200MB" ("0" = no limit)
+}
+
+// extractorRegistry maps file extensions and media types to extractors
+type extractorRegistry struct {
+	byName      map[string]Extractor
+	byFileName  map[string]Extractor
+	byExtension map[string]Extractor
+	byMIMEType  map[string]Extractor
+	maxSizes    map[string]int64
+}
+
+// extractors holds every supported format; the scanner only queues files it
+// has an extractor for
+var extractors = newExtractorRegistry(
+	urlFileExtractor{},
+	weblocExtractor{},
+	desktopExtractor{},
+	chromiumBookmarksExtractor{},
+	firefoxPlacesExtractor{},
+	pdfExtractor{},
+	docxExtractor{},
+	openDocumentExtractor{},
+	epubExtractor{},
+	emlExtractor{},
+	mboxExtractor{},
+	csvExtractor{},
+	jsonExtractor{},
+	yamlExtractor{},
+	opmlExtractor{},
+	feedExtractor{},
+	notebookExtractor{},
+	rstExtractor{},
+	orgExtractor{},
+	asciidocExtractor{},
+	markdownExtractor{},
+	htmlExtractor{},
+	textExtractor{},
+)
+
+// newExtractorRegistry registers each extractor under its name, extensions
+// and media types
+func newExtractorRegistry(list ...Extractor) *extractorRegistry {
+	registry := &extractorRegistry{
+		byName:      make(map[string]Extractor),
+		byFileName:  make(map[string]Extractor),
+		byExtension: make(map[string]Extractor),
+		byMIMEType:  make(map[string]Extractor),
+		maxSizes:    make(map[string]int64),
+	}
+	for _, extractor := range list {
+		registry.register(extractor)
+	}
+	return registry
+}
+
+// register adds an extractor, replacing any registered for the same name,
+// file names, extensions or media types
+func (r *extractorRegistry) register(extractor Extractor) {
+	r.byName[extractor.Name()] = extractor
+	if named, ok := extractor.(fileNameExtractor); ok {
+		for _, name := range named.FileNames() {
+			r.byFileName[name] = extractor
+		}
+	}
+	for _, ext := range extractor.Extensions() {
+		r.byExtension[ext] = extractor
+	}
+	for _, mediaType := range extractor.MIMETypes() {
+		r.byMIMEType[mediaType] = extractor
+	}
+	if limited, ok := extractor.(sizeLimitedExtractor); ok {
+		r.maxSizes[extractor.Name()] = limited.DefaultMaxSize()
+	}
+}
+
+// configure maps the extra extensions in cfg to registered extractors
+func (r *extractorRegistry) configure(cfg ExtractorConfig) error {
+	for ext, name := range cfg.Extensions {
+		extractor, ok := r.byName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return fmt.Errorf("extractors.extensions: unknown extractor %q for %s (expected one of %s)", name, ext, strings.Join(r.names(), ", "))
+		}
+		for _, normalized := range normalizeList([]string{ext}, true) {
+			r.byExtension[normalized] = extractor
+		}
+	}
+
+	for name, size := range cfg.MaxSizes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := r.byName[name]; !ok {
+			return fmt.Errorf("extractors.max_sizes: unknown extractor %q (expected one of %s)", name, strings.Join(r.names(), ", "))
+		}
+		limit, err := parseByteSize(size)
+		if err != nil {
+			return fmt.Errorf("extractors.max_sizes.%s: %w", name, err)
+		}
+		r.maxSizes[name] = limit
+	}
+	return nil
+}
+
+// maxSize returns the size limit for files read by extractor, or 0 for none
+func (r *extractorRegistry) maxSize(extractor Extractor) int64 {
+	return r.maxSizes[extractor.Name()]
+}
+
+// forPath returns the enabled extractor for a file's name or extension, or nil
+func (r *extractorRegistry) forPath(filePath string) Extractor {
+	if extractor, ok := r.byFileName[strings.ToLower(filepath.Base(filePath))]; ok {
+		return enabledOrNil(extractor)
+	}
+	return enabledOrNil(r.byExtension[strings.ToLower(filepath.Ext(filePath))])
+}
+
+// forMIMEType returns the enabled extractor for a Content-Type value, or nil
+func (r *extractorRegistry) forMIMEType(contentType string) Extractor {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	return enabledOrNil(r.byMIMEType[mediaType])
+}
+
+// enabledOrNil returns extractor unless it is an opt-in extractor that has
+// not been configured
+func enabledOrNil(extractor Extractor) Extractor {
+	if optIn, ok := extractor.(optInExtractor); ok && !optIn.Enabled() {
+		return nil
+	}
+	return extractor
+}
+
+// names returns the registered extractor names, sorted
+func (r *extractorRegistry) names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extensions returns the handled file extensions, sorted, followed by the
+// handled file names. Opt-in extractors count once enabled.
+func (r *extractorRegistry) extensions() []string {
+	extensions := make([]string, 0, len(r.byExtension))
+	for ext, extractor := range r.byExtension {
+		if enabledOrNil(extractor) != nil {
+			extensions = append(extensions, ext)
+		}
+	}
+	sort.Strings(extensions)
+
+	names := make([]string, 0, len(r.byFileName))
+	for name, extractor := range r.byFileName {
+		if enabledOrNil(extractor) != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return append(extensions, names...)
+}
+
+// extractLinksFromFile extracts links from a file with the extractor for
+// its name or extension
+func extractLinksFromFile(filePath string) ([]Link, error) {
+	extractor := extractors.forPath(filePath)
+	if extractor == nil {
+		return nil, fmt.Errorf("unsupported file type: %s", filepath.Ext(filePath))
+	}
+
+	// Refuse oversized files before reading any of them
+	if limit := extractors.maxSize(extractor); limit > 0 {
+		if info, err := os.Stat(filePath); err == nil && info.Size() > limit {
+			return nil, fmt.Errorf("file is %s, larger than the %s limit of %s", formatBytes(info.Size()), extractor.Name(), formatBytes(limit))
+		}
+	}
+
+	if fromFile, ok := extractor.(fileExtractor); ok {
+		return fromFile.ExtractFile(filePath)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return extractor.Extract(file)
+}
+
+// readDocument reads all of r, failing if it exceeds extractor's size limit
+func readDocument(r io.Reader, extractor Extractor) ([]byte, error) {
+	limit := extractors.maxSize(extractor)
+	if limit <= 0 {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return content, nil
+	}
+
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("file is larger than the %s limit of %s", extractor.Name(), formatBytes(limit))
+	}
+	return content, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errSizeLimit is returned when a response body exceeds the filter's size limit
+var errSizeLimit = errors.New("size limit exceeded")
+
+// FilterConfig is the JSON form of a download filter in config.json
+type FilterConfig struct {
+	MaxSize             string   `json:"max_size"`
+	ContentTypes        []string `json:"content_types"`
+	ExcludeContentTypes []string `json:"exclude_content_types"`
+	IncludeExtensions   []string `json:"include_extensions"`
+	ExcludeExtensions   []string `json:"exclude_extensions"`
+}
+
+// DownloadFilter decides which URLs are fetched before their bodies are written
+type DownloadFilter struct {
+	MaxSize             int64
+	ContentTypes        []string
+	ExcludeContentTypes []string
+	IncludeExtensions   []string
+	ExcludeExtensions   []string
+}
+
+// FilterSet holds the run-wide filter and per-scan-root overrides
+type FilterSet struct {
+	Default DownloadFilter
+	Roots   map[string]DownloadFilter
+}
+
+// downloadFilters is the active filter set, built from config.json and flags at startup
+var downloadFilters = &FilterSet{}
+
+// newDownloadFilter converts a FilterConfig into a DownloadFilter
+func newDownloadFilter(cfg FilterConfig) (DownloadFilter, error) {
+	filter := DownloadFilter{
+		ContentTypes:        normalizeList(cfg.ContentTypes, false),
+		ExcludeContentTypes: normalizeList(cfg.ExcludeContentTypes, false),
+		IncludeExtensions:   normalizeList(cfg.IncludeExtensions, true),
+		ExcludeExtensions:   normalizeList(cfg.ExcludeExtensions, true),
+	}
+
+	if cfg.MaxSize != "" {
+		size, err := parseByteSize(cfg.MaxSize)
+		if err != nil {
+			return filter, fmt.Errorf("invalid max_size: %w", err)
+		}
+		filter.MaxSize = size
+	}
+
+	return filter, nil
+}
+
+// merge returns f with every field that is set in override replaced
+func (f DownloadFilter) merge(override DownloadFilter) DownloadFilter {
+	if override.MaxSize > 0 {
+		f.MaxSize = override.MaxSize
+	}
+	if len(override.ContentTypes) > 0 {
+		f.ContentTypes = override.ContentTypes
+	}
+	if len(override.ExcludeContentTypes) > 0 {
+		f.ExcludeContentTypes = override.ExcludeContentTypes
+	}
+	if len(override.IncludeExtensions) > 0 {
+		f.IncludeExtensions = override.IncludeExtensions
+	}
+	if len(override.ExcludeExtensions) > 0 {
+		f.ExcludeExtensions = override.ExcludeExtensions
+	}
+	return f
+}
+
+// forPath returns the filter that applies to a source file, using the
+// longest matching scan root override
+func (s *FilterSet) forPath(filePath string) DownloadFilter {
+	filter := s.Default
+	bestLen := -1
+
+	for root, override := range s.Roots {
+		if !isWithinDir(filePath, root) || len(root) <= bestLen {
+			continue
+		}
+		filter = s.Default.merge(override)
+		bestLen = len(root)
+	}
+
+	return filter
+}
+
+// checkName returns a reason if the filename's extension is filtered out
+func (f DownloadFilter) checkName(filename string) string {
+	name := strings.ToLower(filename)
+
+	for _, ext := range f.ExcludeExtensions {
+		if strings.HasSuffix(name, ext) {
+			return fmt.Sprintf("extension %s is excluded", ext)
+		}
+	}
+
+	if len(f.IncludeExtensions) == 0 {
+		return ""
+	}
+	for _, ext := range f.IncludeExtensions {
+		if strings.HasSuffix(name, ext) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("extension of %s is not in the include list", filename)
+}
+
+// checkURL returns a reason if the URL's path extension is filtered out
+func (f DownloadFilter) checkURL(urlStr string) string {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || filepath.Ext(parsedURL.Path) == "" {
+		// Without an extension the decision is deferred to the final filename
+		return ""
+	}
+	return f.checkName(parsedURL.Path)
+}
+
+// checkResponse returns a reason if the response headers are filtered out
+func (f DownloadFilter) checkResponse(resp *http.Response) string {
+	if f.MaxSize > 0 && resp.ContentLength > f.MaxSize {
+		return fmt.Sprintf("size %s exceeds limit %s", formatBytes(resp.ContentLength), formatBytes(f.MaxSize))
+	}
+
+	if len(f.ContentTypes) == 0 && len(f.ExcludeContentTypes) == 0 {
+		return ""
+	}
+
+	// Servers that omit Content-Type are treated as sending opaque bytes
+	contentType := "application/octet-stream"
+	if header := resp.Header.Get("Content-Type"); header != "" {
+		if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+			contentType = mediaType
+		}
+	}
+
+	for _, pattern := range f.ExcludeContentTypes {
+		if matchContentType(pattern, contentType) {
+			return fmt.Sprintf("content type %s is excluded", contentType)
+		}
+	}
+
+	if len(f.ContentTypes) == 0 {
+		return ""
+	}
+	for _, pattern := range f.ContentTypes {
+		if matchContentType(pattern, contentType) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("content type %s is not allowed", contentType)
+}
+
+// matchContentType matches a media type against "type/subtype" or "type/*"
+func matchContentType(pattern, contentType string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, prefix+"/")
+	}
+	return pattern == contentType
+}
+
+// limitedWriter fails with errSizeLimit once more than limit bytes are written
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.limit > 0 && lw.written+int64(len(p)) > lw.limit {
+		return 0, errSizeLimit
+	}
+	n, err := lw.w.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
+
+// normalizeList lowercases and trims list entries, optionally ensuring a
+// leading dot for file extensions
+func normalizeList(values []string, extensions bool) []string {
+	var normalized []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		if extensions && !strings.HasPrefix(value, ".") {
+			value = "." + value
+		}
+		normalized = append(normalized, value)
+	}
+	return normalized
+}
+
+// splitList splits a comma-separated flag value into its entries
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// parseByteSize parses sizes such as "2GB", "500 MB", "1.5G" or "1048576"
+func parseByteSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(value, "IB")
+	value = strings.TrimSuffix(value, "B")
+
+	multiplier := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("cannot parse size %q", size)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
+
+// isWithinDir reports whether path is dir itself or located beneath it
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// savedFromPattern matches the comment browsers add to saved pages, e.g.
+// <!-- saved from url=(0027)https://example.com/page -->
+var savedFromPattern = regexp.MustCompile(`saved from url=\(\d+\)(\S+)`)
+
+// htmlLinkAttributes lists the attributes that hold links, per element
+var htmlLinkAttributes = map[atom.Atom][]string{
+	atom.A:      {"href"},
+	atom.Area:   {"href"},
+	atom.Link:   {"href"},
+	atom.Img:    {"src", "srcset"},
+	atom.Source: {"src", "srcset"},
+	atom.Video:  {"src", "poster"},
+	atom.Audio:  {"src"},
+	atom.Track:  {"src"},
+	atom.Embed:  {"src"},
+	atom.Iframe: {"src"},
+	atom.Frame:  {"src"},
+	atom.Object: {"data"},
+}
+
+// htmlExtractor finds links in HTML pages
+type htmlExtractor struct{}
+
+func (htmlExtractor) Name() string         { return "html" }
+func (htmlExtractor) Extensions() []string { return []string{".html", ".htm"} }
+func (htmlExtractor) MIMETypes() []string  { return []string{"text/html", "application/xhtml+xml"} }
+
+func (htmlExtractor) Extract(r io.Reader) ([]Link, error) {
+	urls, err := parseHTMLLinks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]Link, 0, len(urls))
+	for _, url := range urls {
+		links = append(links, Link{URL: url})
+	}
+	return links, nil
+}
+
+// parseHTMLLinks tokenizes an HTML document and returns the absolute URLs of
+// its links and of plain URLs in its text. Relative links are resolved
+// against <base href>, itself resolved against the page's saved-from URL;
+// without either they cannot be resolved and are dropped. Comments, scripts
+// and stylesheets are ignored.
+func parseHTMLLinks(r io.Reader) ([]string, error) {
+	tokenizer := html.NewTokenizer(r)
+
+	var savedFrom, baseHref string
+	var refs []string
+	skipDepth := 0 // inside <script> or <style>
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, fmt.Errorf("failed to parse HTML: %w", err)
+			}
+			return resolveHTMLLinks(refs, savedFrom, baseHref), nil
+
+		case html.CommentToken:
+			// Only the saved-from marker is read from comments
+			if savedFrom == "" {
+				if match := savedFromPattern.FindStringSubmatch(string(tokenizer.Text())); match != nil {
+					savedFrom = match[1]
+				}
+			}
+
+		case html.TextToken:
+			if skipDepth == 0 {
+				refs = append(refs, findURLs(string(tokenizer.Text()))...)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+
+			switch token.DataAtom {
+			case atom.Script, atom.Style:
+				if tokenType == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			case atom.Base:
+				// The first <base href> applies to the whole document
+				if href := htmlAttr(token, "href"); href != "" && baseHref == "" {
+					baseHref = href
+				}
+				continue
+			case atom.Link:
+				if strings.Contains(strings.ToLower(htmlAttr(token, "rel")), "stylesheet") {
+					continue
+				}
+			}
+
+			for _, name := range htmlLinkAttributes[token.DataAtom] {
+				value := htmlAttr(token, name)
+				if name == "srcset" {
+					refs = append(refs, parseSrcset(value)...)
+				} else if value != "" {
+					refs = append(refs, value)
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if a := atom.Lookup(name); (a == atom.Script || a == atom.Style) && skipDepth > 0 {
+				skipDepth--
+			}
+		}
+	}
+}
+
+// resolveHTMLLinks turns the references found in a page into absolute,
+// valid, de-duplicated URLs in document order
+func resolveHTMLLinks(refs []string, savedFrom, baseHref string) []string {
+	var base *url.URL
+	if parsed, err := url.Parse(strings.TrimSpace(savedFrom)); err == nil && parsed.IsAbs() {
+		base = parsed
+	}
+	if baseHref != "" {
+		if parsed, err := url.Parse(strings.TrimSpace(baseHref)); err == nil {
+			if base != nil {
+				base = base.ResolveReference(parsed)
+			} else if parsed.IsAbs() {
+				base = parsed
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	for _, ref := range refs {
+		// Links within the page itself are not downloads
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			continue
+		}
+
+		parsed, err := url.Parse(ref)
+		if err != nil {
+			continue
+		}
+		if !parsed.IsAbs() {
+			if base == nil {
+				continue
+			}
+			parsed = base.ResolveReference(parsed)
+		}
+
+		// Fragments never change what is downloaded
+		parsed.Fragment = ""
+		parsed.RawFragment = ""
+
+		link := parsed.String()
+		if !seen[link] && isValidURL(link) {
+			seen[link] = true
+			urls = append(urls, link)
+		}
+	}
+
+	return urls
+}
+
+// htmlAttr returns the value of the named attribute of token, or ""
+func htmlAttr(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// parseSrcset returns the URLs of a srcset attribute, e.g.
+// "small.jpg 480w, large.jpg 1080w"
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
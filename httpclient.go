@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutConfig is the JSON form of the HTTP timeouts in config.json.
+// Durations use Go syntax such as "30s" or "5m"; an empty value keeps the default
+// and "0" disables the timeout.
+type TimeoutConfig struct {
+	Connect             string `json:"connect"`
+	TLSHandshake        string `json:"tls_handshake"`
+	ResponseHeader      string `json:"response_header"`
+	Idle                string `json:"idle"`
+	Overall             string `json:"overall"`
+	MinThroughput       string `json:"min_throughput"`
+	MinThroughputWindow string `json:"min_throughput_window"`
+}
+
+// Timeouts holds the parsed HTTP timeouts
+type Timeouts struct {
+	Connect             time.Duration // TCP connect
+	TLSHandshake        time.Duration // TLS handshake
+	ResponseHeader      time.Duration // waiting for response headers after the request is sent
+	Idle                time.Duration // no body data received
+	Overall             time.Duration // whole request including body (0 = no limit)
+	MinThroughput       int64         // bytes per second averaged over MinThroughputWindow (0 = off)
+	MinThroughputWindow time.Duration
+}
+
+// defaultTimeouts bound each phase of a request but let healthy large
+// downloads run as long as they keep receiving data
+var defaultTimeouts = Timeouts{
+	Connect:             30 * time.Second,
+	TLSHandshake:        30 * time.Second,
+	ResponseHeader:      60 * time.Second,
+	Idle:                60 * time.Second,
+	MinThroughputWindow: 30 * time.Second,
+}
+
+// ClientOptions holds the settings used to build the shared HTTP client
+type ClientOptions struct {
+	Timeouts    Timeouts
+	Proxy       func(*http.Request) (*url.URL, error)
+	Credentials *credentials
+	Cookies     *cookieJar
+	TLS         *tlsSettings
+	Network     *networkPolicy
+	Redirects   *redirectPolicy
+
+	MaxConnsPerHost int // 0 = unlimited
+}
+
+// HTTPClient is the shared HTTP client, rebuilt from config.json at startup
+var HTTPClient = newHTTPClient(ClientOptions{
+	Timeouts: defaultTimeouts,
+	Proxy:    http.ProxyFromEnvironment,
+})
+
+// parseTimeouts applies a TimeoutConfig on top of the defaults
+func parseTimeouts(cfg TimeoutConfig) (Timeouts, error) {
+	timeouts := defaultTimeouts
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"connect", cfg.Connect, &timeouts.Connect},
+		{"tls_handshake", cfg.TLSHandshake, &timeouts.TLSHandshake},
+		{"response_header", cfg.ResponseHeader, &timeouts.ResponseHeader},
+		{"idle", cfg.Idle, &timeouts.Idle},
+		{"overall", cfg.Overall, &timeouts.Overall},
+		{"min_throughput_window", cfg.MinThroughputWindow, &timeouts.MinThroughputWindow},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return timeouts, fmt.Errorf("timeouts.%s: %w", d.name, err)
+		}
+		*d.dest = duration
+	}
+
+	if cfg.MinThroughput != "" {
+		rate, err := parseByteSize(cfg.MinThroughput)
+		if err != nil {
+			return timeouts, fmt.Errorf("timeouts.min_throughput: %w", err)
+		}
+		timeouts.MinThroughput = rate
+	}
+
+	if timeouts.MinThroughput > 0 && timeouts.MinThroughputWindow <= 0 {
+		return timeouts, fmt.Errorf("timeouts.min_throughput_window must be positive")
+	}
+
+	return timeouts, nil
+}
+
+// newHTTPClient builds an HTTP client with per-phase timeouts, a body
+// watchdog for stalled or slow transfers, the configured proxies, per-host
+// TLS settings, credentials, cookies and redirect policy
+func newHTTPClient(opts ClientOptions) *http.Client {
+	timeouts := opts.Timeouts
+	dialer := &net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+	transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	transport.Proxy = opts.Proxy
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+
+	// Enforce the outbound network policy on every connection
+	if opts.Network != nil {
+		transport.DialContext = opts.Network.dialContext(dialer)
+		if transport.Proxy != nil {
+			transport.Proxy = opts.Network.wrapProxy(transport.Proxy)
+		}
+	}
+
+	var base http.RoundTripper = transport
+	if opts.TLS != nil {
+		base = newTLSRouter(transport, opts.TLS)
+	}
+	if opts.Network != nil {
+		base = &proxyDialTransport{base: base}
+	}
+	if opts.Credentials != nil {
+		base = &authTransport{base: base, creds: opts.Credentials}
+	}
+
+	client := &http.Client{
+		Transport: &watchdogTransport{
+			base:          base,
+			idle:          timeouts.Idle,
+			minThroughput: timeouts.MinThroughput,
+			window:        timeouts.MinThroughputWindow,
+		},
+		Timeout: timeouts.Overall,
+	}
+	if opts.Cookies != nil {
+		client.Jar = opts.Cookies
+	}
+	if opts.Redirects != nil {
+		client.CheckRedirect = opts.Redirects.check
+	}
+
+	return client
+}
+
+// watchdogTransport wraps response bodies so that transfers which stall or
+// fall below the minimum throughput are aborted with a descriptive error
+type watchdogTransport struct {
+	base          http.RoundTripper
+	idle          time.Duration
+	minThroughput int64
+	window        time.Duration
+}
+
+func (t *watchdogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.idle <= 0 && t.minThroughput <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+
+	resp.Body = newWatchdogBody(ctx, cancel, resp.Body, t.idle, t.minThroughput, t.window)
+	return resp, nil
+}
+
+// watchdogBody cancels its request when no data arrives for the idle timeout
+// or when throughput over a window drops below the minimum
+type watchdogBody struct {
+	body   io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	idle      time.Duration
+	idleTimer *time.Timer
+
+	minThroughput int64
+	window        time.Duration
+	windowTimer   *time.Timer
+	windowBytes   atomic.Int64
+}
+
+func newWatchdogBody(ctx context.Context, cancel context.CancelCauseFunc, body io.ReadCloser, idle time.Duration, minThroughput int64, window time.Duration) *watchdogBody {
+	wb := &watchdogBody{
+		body:          body,
+		ctx:           ctx,
+		cancel:        cancel,
+		idle:          idle,
+		minThroughput: minThroughput,
+		window:        window,
+	}
+
+	if idle > 0 {
+		wb.idleTimer = time.AfterFunc(idle, func() {
+			cancel(fmt.Errorf("transfer stalled: no data received for %s", idle))
+		})
+	}
+	if minThroughput > 0 {
+		wb.windowTimer = time.AfterFunc(window, wb.checkThroughput)
+	}
+
+	return wb
+}
+
+// checkThroughput runs once per window and aborts slow transfers
+func (wb *watchdogBody) checkThroughput() {
+	received := wb.windowBytes.Swap(0)
+	required := int64(float64(wb.minThroughput) * wb.window.Seconds())
+	if received < required {
+		wb.cancel(fmt.Errorf("transfer too slow: %s in %s, minimum is %s/s",
+			formatBytes(received), wb.window, formatBytes(wb.minThroughput)))
+		return
+	}
+	wb.windowTimer.Reset(wb.window)
+}
+
+func (wb *watchdogBody) Read(p []byte) (int, error) {
+	n, err := wb.body.Read(p)
+	if n > 0 {
+		wb.windowBytes.Add(int64(n))
+		if wb.idleTimer != nil {
+			wb.idleTimer.Reset(wb.idle)
+		}
+	}
+	if err != nil && err != io.EOF && wb.ctx.Err() != nil {
+		// Report why the watchdog cancelled the transfer
+		err = context.Cause(wb.ctx)
+	}
+	return n, err
+}
+
+func (wb *watchdogBody) Close() error {
+	if wb.idleTimer != nil {
+		wb.idleTimer.Stop()
+	}
+	if wb.windowTimer != nil {
+		wb.windowTimer.Stop()
+	}
+	err := wb.body.Close()
+	wb.cancel(nil)
+	return err
+}
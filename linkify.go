@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// findURLs returns the http and https URLs written in plain text, in order.
+//
+// A URL starts at "http://" or "https://" (in any case) at the start of a
+// word and runs until whitespace or a character that cannot appear in a
+// URL. Trailing sentence punctuation is then trimmed, and a closing ")" or
+// "]" is only kept if it balances an opening one within the URL, so
+// "(see https://en.wikipedia.org/wiki/Go_(language))." yields the
+// Wikipedia URL. A trailing "_", "*" or "~" is only trimmed when the same
+// character opens the URL, as in the Markdown emphasis "_https://go.dev_".
+// Text without spaces, as in Chinese or Japanese, may continue straight
+// after a URL, so a URL ends where ASCII text changes to CJK script, except
+// after a delimiter such as "/" or "=" that starts a new path segment or
+// query value. Bracketed IPv6 hosts and non-ASCII (IDN) hosts and paths are
+// kept as written; a stray "%" not starting a percent-encoded byte is encoded as
+// "%25" so the URL can be parsed.
+func findURLs(text string) []string {
+	var urls []string
+
+	for i := 0; i < len(text); {
+		start := indexScheme(text, i)
+		if start < 0 {
+			break
+		}
+
+		end := scanURL(text, start)
+		opener, _ := utf8.DecodeLastRuneInString(text[:start])
+		candidate := trimURL(text[start:end], opener)
+		i = start + max(len(candidate), 1)
+
+		// Reject a bare scheme with no host
+		scheme, rest, _ := strings.Cut(candidate, "://")
+		if rest == "" || rest[0] == '/' {
+			continue
+		}
+
+		urls = append(urls, strings.ToLower(scheme)+"://"+fixPercentEncoding(rest))
+	}
+
+	return urls
+}
+
+// indexScheme returns the index of the next "http://" or "https://" at or
+// after from that does not continue a word, or -1
+func indexScheme(text string, from int) int {
+	for i := from; i < len(text); i++ {
+		if text[i] != 'h' && text[i] != 'H' {
+			continue
+		}
+		rest := text[i:]
+		if !hasPrefixFold(rest, "http://") && !hasPrefixFold(rest, "https://") {
+			continue
+		}
+		// Text without spaces, as in Chinese or Japanese, may run straight
+		// into a URL, so only ASCII letters and digits continue a word
+		if i > 0 && isASCIIAlnum(text[i-1]) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// hasPrefixFold is strings.HasPrefix ignoring ASCII case
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// scanURL returns the end of the URL starting at start: the first
+// whitespace, control character or URL terminator, or the first CJK
+// character directly following ASCII text other than a delimiter. A "."
+// between CJK labels, as in a Chinese domain name, does not end the URL.
+func scanURL(text string, start int) int {
+	var previous, beforePrevious rune
+	for i := start; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if endsURL(r) {
+			return i
+		}
+		if isCJK(r) && previous < utf8.RuneSelf && !strings.ContainsRune("/?#&=", previous) &&
+			!(previous == '.' && isCJK(beforePrevious)) {
+			return i
+		}
+		previous, beforePrevious = r, previous
+		i += size
+	}
+	return len(text)
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// endsURL reports whether r cannot be part of a URL written in text
+func endsURL(r rune) bool {
+	switch r {
+	case '<', '>', '"', '`', '{', '}', '|', '\\', '^', utf8.RuneError:
+		return true
+	}
+	if r < utf8.RuneSelf {
+		return r <= ' ' || r == 0x7f
+	}
+	// Outside ASCII, spaces and punctuation such as 。，or 「」 end a URL
+	return unicode.IsSpace(r) || unicode.IsControl(r) || unicode.IsPunct(r)
+}
+
+// trimURL removes trailing punctuation that belongs to the surrounding
+// sentence rather than to the URL. opener is the character before the URL;
+// emphasis markers are only trimmed when they close it.
+func trimURL(candidate string, opener rune) string {
+	for candidate != "" {
+		last, size := utf8.DecodeLastRuneInString(candidate)
+		switch {
+		case strings.ContainsRune(".,;:!?'", last):
+		case strings.ContainsRune("*_~", last) && last == opener:
+		case last == ')' && strings.Count(candidate, ")") > strings.Count(candidate, "("):
+		case last == ']' && strings.Count(candidate, "]") > strings.Count(candidate, "["):
+		default:
+			return candidate
+		}
+		candidate = candidate[:len(candidate)-size]
+	}
+	return candidate
+}
+
+// fixPercentEncoding encodes each "%" that does not start a valid
+// percent-encoded byte as "%25"
+func fixPercentEncoding(rawURL string) string {
+	if !strings.Contains(rawURL, "%") {
+		return rawURL
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(rawURL); i++ {
+		if rawURL[i] == '%' && (i+2 >= len(rawURL) || !isHex(rawURL[i+1]) || !isHex(rawURL[i+2])) {
+			buf.WriteString("%25")
+			continue
+		}
+		buf.WriteByte(rawURL[i])
+	}
+	return buf.String()
+}
+
+// isASCIIAlnum reports whether c is an ASCII letter or digit
+func isASCIIAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
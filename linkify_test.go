@@ -0,0 +1,136 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		// Plain text
+		{"empty", "", nil},
+		{"no url", "nothing to see here", nil},
+		{"bare url", "https://go.dev", []string{"https://go.dev"}},
+		{"http", "http://go.dev/doc", []string{"http://go.dev/doc"}},
+		{"in sentence", "see https://go.dev/doc for more", []string{"https://go.dev/doc"}},
+		{"several", "https://a.test/1 and http://b.test/2", []string{"https://a.test/1", "http://b.test/2"}},
+		{"uppercase scheme", "HTTPS://Go.dev/Doc", []string{"https://Go.dev/Doc"}},
+		{"mixed case scheme", "Http://go.dev", []string{"http://go.dev"}},
+		{"query and fragment", "https://go.dev/s?q=a&b=c#top", []string{"https://go.dev/s?q=a&b=c#top"}},
+		{"port", "http://host.test:8080/x", []string{"http://host.test:8080/x"}},
+		{"userinfo", "https://user@host.test/x", []string{"https://user@host.test/x"}},
+		{"line breaks", "a\nhttps://a.test/x\r\nhttps://b.test/y\n", []string{"https://a.test/x", "https://b.test/y"}},
+		{"tab separated", "https://a.test/x\thttps://b.test/y", []string{"https://a.test/x", "https://b.test/y"}},
+		{"bare scheme", "https:// nothing", nil},
+		{"scheme without host", "https:///path", nil},
+		{"other scheme", "ftp://files.test/x mailto:a@b.test", nil},
+		{"inside word", "xhttps://go.dev", nil},
+		{"after digit", "1https://go.dev", nil},
+		{"after underscore", "snake_https://go.dev", []string{"https://go.dev"}},
+		{"angle brackets", "<https://go.dev/doc>", []string{"https://go.dev/doc"}},
+		{"double quotes", `href="https://go.dev/doc"`, []string{"https://go.dev/doc"}},
+		{"backticks", "`https://go.dev/doc`", []string{"https://go.dev/doc"}},
+		{"braces", "{https://go.dev/doc}", []string{"https://go.dev/doc"}},
+		{"pipe", "|https://a.test|https://b.test|", []string{"https://a.test", "https://b.test"}},
+
+		// Trailing punctuation
+		{"period", "Visit https://go.dev.", []string{"https://go.dev"}},
+		{"comma", "https://a.test/x, https://b.test/y", []string{"https://a.test/x", "https://b.test/y"}},
+		{"semicolon", "https://go.dev/doc;", []string{"https://go.dev/doc"}},
+		{"colon", "at https://go.dev:", []string{"https://go.dev"}},
+		{"exclamation", "wow https://go.dev!", []string{"https://go.dev"}},
+		{"question", "did you see https://go.dev/doc?", []string{"https://go.dev/doc"}},
+		{"single quote", "'https://go.dev/doc'", []string{"https://go.dev/doc"}},
+		{"ellipsis", "https://go.dev/doc...", []string{"https://go.dev/doc"}},
+		{"several marks", "https://go.dev/doc?!.", []string{"https://go.dev/doc"}},
+		{"inner period kept", "https://go.dev/doc/go1.22.html", []string{"https://go.dev/doc/go1.22.html"}},
+		{"inner comma kept", "https://a.test/x,y", []string{"https://a.test/x,y"}},
+		{"query kept", "https://a.test/x?a=1.", []string{"https://a.test/x?a=1"}},
+		{"trailing slash kept", "https://a.test/x/.", []string{"https://a.test/x/"}},
+
+		// Emphasis markers
+		{"trailing underscore kept", "https://foo.org/path_", []string{"https://foo.org/path_"}},
+		{"trailing underscore before period", "see https://foo.org/path_.", []string{"https://foo.org/path_"}},
+		{"trailing asterisk kept", "https://foo.org/glob*", []string{"https://foo.org/glob*"}},
+		{"trailing tilde kept", "https://foo.org/~user/~", []string{"https://foo.org/~user/~"}},
+		{"underscore emphasis", "_https://go.dev/doc_", []string{"https://go.dev/doc"}},
+		{"asterisk emphasis", "*https://go.dev/doc*", []string{"https://go.dev/doc"}},
+		{"strong emphasis", "**https://go.dev/doc**", []string{"https://go.dev/doc"}},
+		{"strikethrough", "~~https://go.dev/doc~~", []string{"https://go.dev/doc"}},
+		{"emphasis then period", "_https://go.dev/doc_.", []string{"https://go.dev/doc"}},
+		{"underscore emphasis keeps inner", "_https://foo.org/a_b_", []string{"https://foo.org/a_b"}},
+		{"mismatched emphasis", "*https://foo.org/path_", []string{"https://foo.org/path_"}},
+
+		// Balanced parentheses and brackets
+		{"wikipedia", "https://en.wikipedia.org/wiki/Go_(programming_language)", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"wikipedia in parens", "(see https://en.wikipedia.org/wiki/Go_(language)).", []string{"https://en.wikipedia.org/wiki/Go_(language)"}},
+		{"in parens", "(https://go.dev/doc)", []string{"https://go.dev/doc"}},
+		{"in parens with period", "(https://go.dev/doc).", []string{"https://go.dev/doc"}},
+		{"nested parens", "https://a.test/x_((y))", []string{"https://a.test/x_((y))"}},
+		{"unbalanced extra closer", "(https://a.test/x_(y)))", []string{"https://a.test/x_(y)"}},
+		{"paren in middle", "https://a.test/(x)/y", []string{"https://a.test/(x)/y"}},
+		{"in brackets", "[https://go.dev/doc]", []string{"https://go.dev/doc"}},
+		{"balanced brackets", "https://a.test/x[1]", []string{"https://a.test/x[1]"}},
+		{"markdown link", "[Go](https://go.dev/doc)", []string{"https://go.dev/doc"}},
+
+		// IPv6
+		{"ipv6", "http://[2001:db8::1]/x", []string{"http://[2001:db8::1]/x"}},
+		{"ipv6 port", "http://[2001:db8::1]:8080/x", []string{"http://[2001:db8::1]:8080/x"}},
+		{"ipv6 bare", "http://[::1]", []string{"http://[::1]"}},
+		{"ipv6 in parens", "(http://[2001:db8::1]/x)", []string{"http://[2001:db8::1]/x"}},
+		{"ipv6 period", "at http://[2001:db8::1].", []string{"http://[2001:db8::1]"}},
+		{"ipv4 mapped", "http://[::ffff:192.0.2.1]/", []string{"http://[::ffff:192.0.2.1]/"}},
+		{"ipv4", "http://192.0.2.1:8080/x.", []string{"http://192.0.2.1:8080/x"}},
+
+		// Internationalised domain names and paths
+		{"idn host", "https://bücher.example.test/katalog", []string{"https://bücher.example.test/katalog"}},
+		{"idn cyrillic", "https://пример.испытание/путь", []string{"https://пример.испытание/путь"}},
+		{"idn greek", "see https://παράδειγμα.δοκιμή.", []string{"https://παράδειγμα.δοκιμή"}},
+		{"punycode", "https://xn--bcher-kva.test/", []string{"https://xn--bcher-kva.test/"}},
+		{"unicode path", "https://a.test/café/menü", []string{"https://a.test/café/menü"}},
+		{"emoji path", "https://a.test/🙂", []string{"https://a.test/🙂"}},
+		{"unicode space ends", "https://a.test/x more", []string{"https://a.test/x"}},
+		{"ideographic space ends", "https://a.test/x　more", []string{"https://a.test/x"}},
+
+		// Percent-encoding
+		{"encoded kept", "https://a.test/a%20b", []string{"https://a.test/a%20b"}},
+		{"encoded lowercase hex", "https://a.test/%e2%82%ac", []string{"https://a.test/%e2%82%ac"}},
+		{"encoded query", "https://a.test/?q=%3D%26", []string{"https://a.test/?q=%3D%26"}},
+		{"stray percent", "https://a.test/100%", []string{"https://a.test/100%25"}},
+		{"stray percent in path", "https://a.test/100%off", []string{"https://a.test/100%25off"}},
+		{"half escape", "https://a.test/a%2", []string{"https://a.test/a%252"}},
+		{"non hex escape", "https://a.test/a%zz", []string{"https://a.test/a%25zz"}},
+		{"mixed escapes", "https://a.test/%41%g1", []string{"https://a.test/%41%25g1"}},
+		{"escape then period", "https://a.test/a%2F.", []string{"https://a.test/a%2F"}},
+
+		// CJK text
+		{"chinese prose after url", "请访问https://go.dev/doc了解更多", []string{"https://go.dev/doc"}},
+		{"chinese prose after host", "见https://go.dev了解", []string{"https://go.dev"}},
+		{"japanese prose after url", "詳細はhttps://go.dev/docをご覧ください", []string{"https://go.dev/doc"}},
+		{"korean prose after url", "링크https://go.dev/doc입니다", []string{"https://go.dev/doc"}},
+		{"cjk query value", "https://a.test/search?q=中文", []string{"https://a.test/search?q=中文"}},
+		{"cjk path then prose", "https://a.test/文档了解", []string{"https://a.test/文档了解"}},
+		{"cjk host", "https://例子.测试/路径", []string{"https://例子.测试/路径"}},
+		{"chinese full stop", "请访问 https://go.dev/doc。谢谢", []string{"https://go.dev/doc"}},
+		{"chinese comma", "网址https://a.test/x，还有https://b.test/y", []string{"https://a.test/x", "https://b.test/y"}},
+		{"japanese brackets", "「https://go.dev/doc」を参照", []string{"https://go.dev/doc"}},
+		{"japanese touten", "詳細はhttps://go.dev/doc、または", []string{"https://go.dev/doc"}},
+		{"fullwidth parens", "（https://go.dev/doc）", []string{"https://go.dev/doc"}},
+		{"korean", "링크: https://go.dev/doc 입니다", []string{"https://go.dev/doc"}},
+		{"cjk path", "https://a.test/文档/", []string{"https://a.test/文档/"}},
+		{"fullwidth colon", "链接：https://go.dev/doc", []string{"https://go.dev/doc"}},
+		{"corner brackets pair", "『https://a.test/x』『https://b.test/y』", []string{"https://a.test/x", "https://b.test/y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findURLs(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("findURLs(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
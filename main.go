@@ -1,32 +1,70 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 )
 
 // Config holds the application configuration
 type Config struct {
-	CompletionChime string `json:"completion_chime"`
+	CompletionChime  string                    `json:"completion_chime"`
+	FilenameProfile  string                    `json:"filename_profile"`
+	FilenameTemplate string                    `json:"filename_template"`
+	MinFreeSpace     string                    `json:"min_free_space"`
+	DownloadQuota    string                    `json:"download_quota"`
+	Timeouts         TimeoutConfig             `json:"timeouts"`
+	Proxy            ProxyConfig               `json:"proxy"`
+	Auth             AuthConfig                `json:"auth"`
+	Cookies          CookieConfig              `json:"cookies"`
+	TLS              TLSConfig                 `json:"tls"`
+	Network          NetworkConfig             `json:"network"`
+	Redirects        RedirectConfig            `json:"redirects"`
+	MaxConnsPerHost  int                       `json:"max_connections_per_host"`
+	Segmented        SegmentConfig             `json:"segmented_downloads"`
+	Wayback          WaybackConfig             `json:"wayback"`
+	Metadata         MetadataConfig            `json:"metadata"`
+	PreserveModTime  *bool                     `json:"preserve_mtime"`
+	Markdown         MarkdownConfig            `json:"markdown"`
+	Extractors       ExtractorConfig           `json:"extractors"`
+	Bookmarks        BookmarkConfig            `json:"bookmarks"`
+	Email            EmailConfig               `json:"email"`
+	Structured       StructuredConfig          `json:"structured"`
+	Filters          FilterConfig              `json:"filters"`
+	ScanRoots        map[string]ScanRootConfig `json:"scan_roots"`
+}
+
+// ScanRootConfig holds settings that apply only to files under one scan root
+type ScanRootConfig struct {
+	Filters FilterConfig `json:"filters"`
 }
 
 // Stats holds atomic counters for processing statistics
 type Stats struct {
-	FilesScanned    int32
-	URLsFound       int32
-	DownloadSuccess int32
-	DownloadSkipped int32
-	DownloadFailed  int32
+	FilesScanned     int32
+	URLsFound        int32
+	DownloadSuccess  int32
+	DownloadArchived int32
+	DownloadSkipped  int32
+	DownloadFiltered int32
+	DownloadFailed   int32
 }
 
+// errInterrupted is the cancellation cause used when a signal stops the run
+var errInterrupted = errors.New("interrupted")
+
 // scanDirsFlag is a custom flag type for repeatable -scan arguments
 type scanDirsFlag []string
 
@@ -44,10 +82,24 @@ func main() {
 	var scanDirs scanDirsFlag
 	var workers int
 	var recursive bool
+	var runFilter FilterConfig
+	var contentTypes, excludeContentTypes, includeExt, excludeExt string
+	var minFree, quota string
+	var cookiesFile string
+	var useWayback bool
 
 	flag.Var(&scanDirs, "scan", "Directory to scan (can be specified multiple times)")
 	flag.IntVar(&workers, "workers", 0, "Number of concurrent download workers (required)")
 	flag.BoolVar(&recursive, "recursive", false, "Scan subdirectories recursively")
+	flag.StringVar(&runFilter.MaxSize, "max-size", "", "Skip downloads larger than this size (e.g. 2GB, 500MB)")
+	flag.StringVar(&contentTypes, "content-types", "", "Comma-separated Content-Types to allow (e.g. application/zip,application/pdf,image/*)")
+	flag.StringVar(&excludeContentTypes, "exclude-content-types", "", "Comma-separated Content-Types to skip")
+	flag.StringVar(&includeExt, "include-ext", "", "Comma-separated file extensions to allow (e.g. .zip,.pdf)")
+	flag.StringVar(&excludeExt, "exclude-ext", "", "Comma-separated file extensions to skip")
+	flag.StringVar(&minFree, "min-free", "", "Free space to keep on the target disk (e.g. 5GB)")
+	flag.StringVar(&quota, "quota", "", "Stop starting downloads after this many bytes in total (e.g. 50GB)")
+	flag.StringVar(&cookiesFile, "cookies", "", "Netscape-format cookies.txt to send with requests")
+	flag.BoolVar(&useWayback, "wayback", false, "Download dead links (404/410, unknown host) from the Wayback Machine")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s -workers <num> -scan <dir1> [-scan <dir2>...] [--recursive]\n\n", os.Args[0])
@@ -76,6 +128,80 @@ func main() {
 		config = &Config{} // Use empty config
 	}
 
+	// Select filename sanitisation rules
+	profile, err := parseFilenameProfile(config.FilenameProfile)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	filenameProfile = profile
+	if filenameTemplate, err = parseFilenameTemplate(config.FilenameTemplate); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Configure link extraction
+	markdownOptions = config.Markdown
+	bookmarkOptions = config.Bookmarks
+	emailOptions = config.Email
+	if structured, err = newStructuredSettings(config.Structured); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := extractors.configure(config.Extractors); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Build download filters: config.json, then per-run flags on top
+	runFilter.ContentTypes = splitList(contentTypes)
+	runFilter.ExcludeContentTypes = splitList(excludeContentTypes)
+	runFilter.IncludeExtensions = splitList(includeExt)
+	runFilter.ExcludeExtensions = splitList(excludeExt)
+	if err := buildDownloadFilters(config, runFilter); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Configure disk space reserve and download quota (flags override config)
+	if minFree != "" {
+		config.MinFreeSpace = minFree
+	}
+	if quota != "" {
+		config.DownloadQuota = quota
+	}
+	if err := configureDiskGuard(config); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Build the shared HTTP client
+	if cookiesFile != "" {
+		config.Cookies.File = cookiesFile
+	}
+	clientOptions, err := buildClientOptions(config)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	HTTPClient = newHTTPClient(clientOptions)
+
+	// Configure parallel segmented downloads within the per-host limit
+	segmentation, err = newSegmentSettings(config.Segmented, config.MaxConnsPerHost)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Configure the Wayback Machine fallback for dead links
+	if useWayback {
+		config.Wayback.Enabled = true
+	}
+	wayback, err = newWaybackSettings(config.Wayback)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Record provenance of downloaded files
+	provenance = config.Metadata
+
+	// Date files by the server's Last-Modified unless turned off
+	if config.PreserveModTime != nil {
+		preserveModTime = *config.PreserveModTime
+	}
+
 	// Convert scan directories to absolute paths and verify existence
 	for i, dir := range scanDirs {
 		absDir, err := filepath.Abs(dir)
@@ -95,12 +221,34 @@ func main() {
 	fmt.Printf("==================\n")
 	fmt.Printf("Workers: %d\n", workers)
 	fmt.Printf("Recursive: %v\n", recursive)
+	fmt.Printf("Filename profile: %s\n", filenameProfile)
+	if filenameTemplate != "" {
+		fmt.Printf("Filename template: %s\n", filenameTemplate)
+	}
+	fmt.Printf("File types: %s\n", strings.Join(extractors.extensions(), " "))
+	if segmentation.segments > 1 {
+		fmt.Printf("Segmented downloads: %d segments for files >= %s\n", segmentation.segments, formatBytes(segmentation.minSize))
+	}
+	if wayback.enabled {
+		fmt.Printf("Wayback fallback: %s\n", redact(wayback.endpoint.String()))
+	}
+	if diskGuard.Reserve > 0 {
+		fmt.Printf("Disk reserve: %s\n", formatBytes(diskGuard.Reserve))
+	}
+	if diskGuard.Quota > 0 {
+		fmt.Printf("Download quota: %s\n", formatBytes(diskGuard.Quota))
+	}
 	fmt.Printf("Scan directories:\n")
 	for _, dir := range scanDirs {
 		fmt.Printf("  - %s\n", dir)
 	}
 	fmt.Println()
 
+	// Stop gracefully on the first SIGINT/SIGTERM, force exit on the second
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go handleSignals(cancel)
+
 	// Create channels for job distribution and result collection
 	jobs := make(chan string, 100)
 	results := make(chan Result, 100)
@@ -112,7 +260,7 @@ func main() {
 	var workerWg sync.WaitGroup
 	for i := 0; i < workers; i++ {
 		workerWg.Add(1)
-		go worker(i+1, jobs, results, &workerWg)
+		go worker(ctx, i+1, jobs, results, &workerWg)
 	}
 
 	// Start result collector
@@ -122,14 +270,17 @@ func main() {
 
 	// Scan directories and send files to workers
 	for _, scanDir := range scanDirs {
-		scanDirectoryWithBatches(scanDir, recursive, jobs, stats)
+		if ctx.Err() != nil {
+			break
+		}
+		scanDirectoryWithBatches(ctx, scanDir, recursive, jobs, stats)
 	}
 
 	// Shutdown sequence
-	close(jobs)         // No more files to process
-	workerWg.Wait()     // Wait for all workers to finish
-	close(results)      // No more results to collect
-	collectorWg.Wait()  // Wait for collector to finish
+	close(jobs)        // No more files to process
+	workerWg.Wait()    // Wait for all workers to finish
+	close(results)     // No more results to collect
+	collectorWg.Wait() // Wait for collector to finish
 
 	// Print summary statistics
 	fmt.Printf("\n")
@@ -138,8 +289,30 @@ func main() {
 	fmt.Printf("Files scanned: %d\n", atomic.LoadInt32(&stats.FilesScanned))
 	fmt.Printf("URLs found: %d\n", atomic.LoadInt32(&stats.URLsFound))
 	fmt.Printf("Downloads succeeded: %d\n", atomic.LoadInt32(&stats.DownloadSuccess))
+	if archived := atomic.LoadInt32(&stats.DownloadArchived); archived > 0 {
+		fmt.Printf("  Recovered from archive: %d\n", archived)
+	}
 	fmt.Printf("Downloads skipped: %d\n", atomic.LoadInt32(&stats.DownloadSkipped))
+	fmt.Printf("Downloads filtered: %d\n", atomic.LoadInt32(&stats.DownloadFiltered))
 	fmt.Printf("Downloads failed: %d\n", atomic.LoadInt32(&stats.DownloadFailed))
+	if ctx.Err() != nil {
+		fmt.Printf("Stopped early: interrupted by signal\n")
+	}
+	if diskGuard.quotaExhausted() {
+		fmt.Printf("Stopped early: download quota of %s exhausted (%s downloaded)\n",
+			formatBytes(diskGuard.Quota), formatBytes(diskGuard.usedBytes()))
+	}
+
+	// Persist cookies set during the run
+	if config.Cookies.Save && clientOptions.Cookies != nil {
+		savePath := config.Cookies.SaveFile
+		if savePath == "" {
+			savePath = config.Cookies.File
+		}
+		if err := clientOptions.Cookies.saveNetscapeFile(savePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save cookies to %s: %v\n", savePath, err)
+		}
+	}
 
 	// Play completion chime if configured
 	if config.CompletionChime != "" {
@@ -147,6 +320,21 @@ func main() {
 	}
 }
 
+// handleSignals cancels the run on the first interrupt so scanning stops and
+// in-flight downloads clean up, and exits immediately on the second
+func handleSignals(cancel context.CancelCauseFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	<-signals
+	fmt.Fprintf(os.Stderr, "\nInterrupt received, stopping (press Ctrl-C again to force exit)...\n")
+	cancel(errInterrupted)
+
+	<-signals
+	fmt.Fprintf(os.Stderr, "\nForced exit\n")
+	os.Exit(130)
+}
+
 // loadConfig loads the configuration from a JSON file
 func loadConfig(path string) (*Config, error) {
 	// Get executable directory
@@ -176,6 +364,126 @@ func loadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
+// buildDownloadFilters sets downloadFilters from the config file's global and
+// per-scan-root filters, with the per-run filter from flags taking precedence
+func buildDownloadFilters(config *Config, runFilter FilterConfig) error {
+	globalFilter, err := newDownloadFilter(config.Filters)
+	if err != nil {
+		return fmt.Errorf("config filters: %w", err)
+	}
+
+	flagFilter, err := newDownloadFilter(runFilter)
+	if err != nil {
+		return fmt.Errorf("-max-size: %w", err)
+	}
+
+	filters := &FilterSet{
+		Default: globalFilter.merge(flagFilter),
+		Roots:   make(map[string]DownloadFilter),
+	}
+
+	for root, rootConfig := range config.ScanRoots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("scan root %s: %w", root, err)
+		}
+
+		rootFilter, err := newDownloadFilter(rootConfig.Filters)
+		if err != nil {
+			return fmt.Errorf("scan root %s filters: %w", root, err)
+		}
+
+		// Per-run flags still win over per-root settings
+		filters.Roots[absRoot] = rootFilter.merge(flagFilter)
+	}
+
+	downloadFilters = filters
+	return nil
+}
+
+// configureDiskGuard sets the disk space reserve and download quota
+func configureDiskGuard(config *Config) error {
+	if config.MinFreeSpace != "" {
+		reserve, err := parseByteSize(config.MinFreeSpace)
+		if err != nil {
+			return fmt.Errorf("min_free_space: %w", err)
+		}
+		diskGuard.Reserve = reserve
+	}
+
+	if config.DownloadQuota != "" {
+		quota, err := parseByteSize(config.DownloadQuota)
+		if err != nil {
+			return fmt.Errorf("download_quota: %w", err)
+		}
+		diskGuard.Quota = quota
+	}
+
+	return nil
+}
+
+// buildClientOptions collects the HTTP client settings from the config file
+func buildClientOptions(config *Config) (ClientOptions, error) {
+	timeouts, err := parseTimeouts(config.Timeouts)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+
+	proxies, err := newProxySelector(config.Proxy)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+
+	network, err := newNetworkPolicy(config.Network)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+
+	redirects, err := newRedirectPolicy(config.Redirects)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+
+	tlsSettings, err := newTLSSettings(config.TLS)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+
+	creds, err := newCredentials(config.Auth)
+	if err != nil {
+		return ClientOptions{}, err
+	}
+	githubToken = creds.githubToken
+
+	// Load browser cookies for logged-in downloads
+	var jar *cookieJar
+	if config.Cookies.File != "" || config.Cookies.SaveFile != "" {
+		jar = newCookieJar()
+		if config.Cookies.File != "" {
+			// A missing file is fine when it will be created on save
+			count, err := jar.loadNetscapeFile(config.Cookies.File)
+			switch {
+			case err == nil:
+				fmt.Printf("Loaded %d cookie(s) from %s\n", count, config.Cookies.File)
+			case !(os.IsNotExist(err) && config.Cookies.Save):
+				return ClientOptions{}, fmt.Errorf("cookies %s: %w", config.Cookies.File, err)
+			}
+		}
+	}
+
+	return ClientOptions{
+		Timeouts:    timeouts,
+		Proxy:       proxies.Proxy,
+		Credentials: creds,
+		Cookies:     jar,
+		TLS:         tlsSettings,
+		Network:     network,
+		Redirects:   redirects,
+
+		MaxConnsPerHost: config.MaxConnsPerHost,
+	}, nil
+}
+
 // playCompletionChime plays an audio file as a completion notification
 func playCompletionChime(path string) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Lightweight markup formats are parsed by their own link syntax first; the
+// spans of recognised links are then removed so the plain-URL linkifier only
+// sees the remaining text. Literal and code blocks follow the Markdown
+// code_block_links option.
+
+// rstExtractor reads reStructuredText documents
+type rstExtractor struct{}
+
+func (rstExtractor) Name() string         { return "rst" }
+func (rstExtractor) Extensions() []string { return []string{".rst", ".rest"} }
+func (rstExtractor) MIMETypes() []string  { return []string{"text/x-rst"} }
+
+func (rstExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := readMarkup(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var links linkSet
+	addRSTLinks(&links, strings.Split(content, "\n"))
+	return links.links, nil
+}
+
+// rstLiteralDirectives are directives whose content is code or other
+// literal text
+var rstLiteralDirectives = []string{"code", "code-block", "sourcecode", "literalinclude", "highlight", "math", "parsed-literal"}
+
+// addRSTLinks adds the links in reStructuredText lines: hyperlink targets,
+// embedded URIs, image and figure directives, raw HTML and standalone URLs.
+// Comments are skipped.
+func addRSTLinks(links *linkSet, lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			addRSTInline(links, strings.Join(paragraph, "\n"))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		indent := indentOf(line)
+
+		// Explicit markup (".. ") and anonymous targets ("__ ") run to the
+		// end of their indented block
+		if trimmed == ".." || strings.HasPrefix(trimmed, ".. ") || strings.HasPrefix(trimmed, "__ ") {
+			flush()
+			end := indentedBlockEnd(lines, i, indent)
+			addRSTExplicit(links, lines[i:end])
+			i = end - 1
+			continue
+		}
+
+		paragraph = append(paragraph, line)
+
+		// A paragraph ending in "::" introduces an indented literal block
+		if strings.HasSuffix(trimmed, "::") {
+			flush()
+			end := indentedBlockEnd(lines, i, indent)
+			if markdownOptions.CodeBlockLinks {
+				links.addText(strings.Join(lines[i+1:end], "\n"))
+			}
+			i = end - 1
+		}
+	}
+	flush()
+}
+
+// addRSTExplicit adds the links of an explicit markup block: a hyperlink
+// target, a directive or a comment
+func addRSTExplicit(links *linkSet, block []string) {
+	first := strings.TrimSpace(block[0])
+	rest := block[1:]
+
+	// Anonymous target: "__ url"
+	if strings.HasPrefix(first, "__ ") {
+		addRSTTarget(links, "", first[3:], rest)
+		return
+	}
+
+	body := strings.TrimSpace(strings.TrimPrefix(first, ".."))
+
+	// Named or anonymous hyperlink target: ".. _name: url", ".. __: url"
+	if strings.HasPrefix(body, "_") {
+		name, uri, ok := splitRSTTarget(body[1:])
+		if ok {
+			if name == "_" {
+				name = ""
+			}
+			addRSTTarget(links, name, uri, rest)
+		}
+		return
+	}
+
+	// Substitution definitions wrap a directive: ".. |name| image:: url"
+	if strings.HasPrefix(body, "|") {
+		if end := strings.Index(body[1:], "|"); end >= 0 {
+			body = strings.TrimSpace(body[end+2:])
+		}
+	}
+
+	// Anything else without "::" is a comment
+	name, argument, ok := strings.Cut(body, "::")
+	if !ok || strings.ContainsAny(strings.TrimSpace(name), " \t") {
+		return
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	argument = strings.TrimSpace(argument)
+
+	if name == "image" || name == "figure" {
+		links.add(strings.Join(strings.Fields(argument), ""), "")
+	}
+
+	// Options come first in the content, then a blank line and the body
+	content := dedent(rest)
+	var options, contentBody []string
+	for i, line := range content {
+		if !strings.HasPrefix(strings.TrimSpace(line), ":") {
+			contentBody = content[i:]
+			break
+		}
+		options = append(options, line)
+	}
+	for _, option := range options {
+		key, value, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(option), ":"), ":")
+		if key == "target" {
+			links.add(strings.TrimSpace(value), "")
+		}
+	}
+
+	switch {
+	case name == "image" || name == "figure":
+		addRSTLinks(links, contentBody)
+	case name == "raw":
+		if strings.EqualFold(argument, "html") {
+			links.addHTML(strings.Join(contentBody, "\n"))
+		}
+	case containsFold(rstLiteralDirectives, name):
+		if markdownOptions.CodeBlockLinks {
+			links.addText(strings.Join(contentBody, "\n"))
+		}
+	default:
+		addRSTLinks(links, append([]string{argument}, contentBody...))
+	}
+}
+
+// splitRSTTarget splits "name: uri" or "`name: with colon`: uri" after the
+// target's leading underscore
+func splitRSTTarget(target string) (name, uri string, ok bool) {
+	if strings.HasPrefix(target, "`") {
+		end := strings.Index(target[1:], "`")
+		if end < 0 {
+			return "", "", false
+		}
+		name, target = target[1:end+1], target[end+2:]
+		if !strings.HasPrefix(target, ":") {
+			return "", "", false
+		}
+		return name, target[1:], true
+	}
+
+	// The name ends at the first unescaped colon followed by a space
+	for i := 0; i < len(target); i++ {
+		if target[i] == '\\' {
+			i++
+			continue
+		}
+		if target[i] == ':' && (i+1 == len(target) || target[i+1] == ' ' || target[i+1] == '\t') {
+			return strings.ReplaceAll(target[:i], `\`, ""), target[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// addRSTTarget adds the URI of a hyperlink target, which may continue on the
+// following indented lines. Whitespace in URIs is dropped, as docutils does;
+// URIs ending in "_" point to another target rather than a URL.
+func addRSTTarget(links *linkSet, name, uri string, continuation []string) {
+	uri = strings.Join(strings.Fields(uri+" "+strings.Join(continuation, " ")), "")
+	if strings.HasSuffix(uri, "_") && !strings.HasSuffix(uri, `\_`) {
+		return
+	}
+	links.add(strings.ReplaceAll(uri, `\_`, "_"), strings.Join(strings.Fields(name), " "))
+}
+
+// addRSTInline adds the embedded URIs of phrase references such as
+// `Python <https://www.python.org/>`_, then the standalone URLs in the rest
+// of the paragraph. Inline literals are skipped.
+func addRSTInline(links *linkSet, text string) {
+	var rest strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			rest.WriteString(text[i : i+2])
+			i++
+			continue
+		}
+		if text[i] != '`' {
+			rest.WriteByte(text[i])
+			continue
+		}
+
+		// ``inline literal``
+		if strings.HasPrefix(text[i:], "``") {
+			end := strings.Index(text[i+2:], "``")
+			if end < 0 {
+				rest.WriteString(text[i:])
+				break
+			}
+			if markdownOptions.CodeBlockLinks {
+				rest.WriteString(" " + text[i+2:i+2+end] + " ")
+			}
+			i += end + 3
+			continue
+		}
+
+		// `phrase`_ or `phrase`__, possibly with an embedded <uri>
+		end := strings.IndexByte(text[i+1:], '`')
+		if end < 0 {
+			rest.WriteString(text[i:])
+			break
+		}
+		phrase := text[i+1 : i+1+end]
+		after := i + 2 + end
+		if after >= len(text) || text[after] != '_' {
+			rest.WriteString(text[i:after])
+			i = after - 1
+			continue
+		}
+		for after < len(text) && text[after] == '_' {
+			after++
+		}
+
+		label := phrase
+		if strings.HasSuffix(phrase, ">") {
+			if open := strings.LastIndex(phrase, "<"); open >= 0 {
+				label = strings.TrimSpace(phrase[:open])
+				addRSTTarget(links, label, phrase[open+1:len(phrase)-1], nil)
+			}
+		}
+		rest.WriteString(" " + label + " ")
+		i = after - 1
+	}
+
+	links.addText(rest.String())
+}
+
+// orgExtractor reads Org-mode documents
+type orgExtractor struct{}
+
+func (orgExtractor) Name() string         { return "org" }
+func (orgExtractor) Extensions() []string { return []string{".org"} }
+func (orgExtractor) MIMETypes() []string  { return []string{"text/org"} }
+
+func (orgExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := readMarkup(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop comments and literal blocks, and collect link abbreviations
+	// defined with "#+LINK: name url"
+	abbreviations := make(map[string]string)
+	var text strings.Builder
+	literal := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		upper := strings.ToUpper(trimmed)
+
+		if literal != "" {
+			if strings.HasPrefix(upper, "#+END_"+literal) {
+				literal = ""
+			} else if markdownOptions.CodeBlockLinks {
+				text.WriteString(line + "\n")
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(upper, "#+BEGIN_SRC"), strings.HasPrefix(upper, "#+BEGIN_EXAMPLE"), strings.HasPrefix(upper, "#+BEGIN_EXPORT"):
+			literal = strings.Fields(upper[len("#+BEGIN_"):])[0]
+		case strings.HasPrefix(upper, "#+LINK:"):
+			fields := strings.Fields(trimmed[len("#+LINK:"):])
+			if len(fields) == 2 {
+				abbreviations[fields[0]] = fields[1]
+			}
+		case trimmed == "#" || strings.HasPrefix(trimmed, "# "):
+			// Comment line
+		case trimmed == ":" || strings.HasPrefix(trimmed, ": "):
+			// Fixed-width (literal) line
+			if markdownOptions.CodeBlockLinks {
+				text.WriteString(line + "\n")
+			}
+		default:
+			text.WriteString(line + "\n")
+		}
+	}
+
+	var links linkSet
+	addOrgInline(&links, text.String(), abbreviations)
+	return links.links, nil
+}
+
+// addOrgInline adds bracket links, [[url]] and [[url][description]], then
+// the plain and angle-bracket URLs in the rest of the text
+func addOrgInline(links *linkSet, text string, abbreviations map[string]string) {
+	var rest strings.Builder
+	for {
+		start := strings.Index(text, "[[")
+		if start < 0 {
+			break
+		}
+		rest.WriteString(text[:start])
+
+		target, description, end, ok := parseOrgLink(text[start:])
+		if !ok {
+			rest.WriteString("[[")
+			text = text[start+2:]
+			continue
+		}
+
+		links.add(expandOrgLink(target, abbreviations), strings.Join(strings.Fields(description), " "))
+		rest.WriteString(" " + description + " ")
+		text = text[start+end:]
+	}
+	rest.WriteString(text)
+
+	links.addText(rest.String())
+}
+
+// parseOrgLink parses a bracket link at the start of text, returning its
+// unescaped target, its description and its length
+func parseOrgLink(text string) (target, description string, length int, ok bool) {
+	var buf strings.Builder
+	for i := 2; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text) && (text[i+1] == '[' || text[i+1] == ']' || text[i+1] == '\\'):
+			buf.WriteByte(text[i+1])
+			i++
+		case strings.HasPrefix(text[i:], "]]"):
+			return buf.String(), "", i + 2, true
+		case strings.HasPrefix(text[i:], "]["):
+			end := strings.Index(text[i+2:], "]]")
+			if end < 0 {
+				return "", "", 0, false
+			}
+			return buf.String(), text[i+2 : i+2+end], i + 4 + end, true
+		case text[i] == '[' || text[i] == ']':
+			return "", "", 0, false
+		default:
+			buf.WriteByte(text[i])
+		}
+	}
+	return "", "", 0, false
+}
+
+// expandOrgLink replaces a "name:tag" abbreviation by its URL, substituting
+// %s with the tag or appending it
+func expandOrgLink(target string, abbreviations map[string]string) string {
+	name, tag, ok := strings.Cut(strings.TrimSpace(target), ":")
+	if !ok {
+		name, tag = target, ""
+	}
+	expansion, ok := abbreviations[name]
+	if !ok {
+		return target
+	}
+	if strings.Contains(expansion, "%s") {
+		return strings.Replace(expansion, "%s", tag, 1)
+	}
+	return expansion + tag
+}
+
+// asciidocExtractor reads AsciiDoc documents
+type asciidocExtractor struct{}
+
+func (asciidocExtractor) Name() string         { return "asciidoc" }
+func (asciidocExtractor) Extensions() []string { return []string{".adoc", ".asciidoc"} }
+func (asciidocExtractor) MIMETypes() []string  { return []string{"text/asciidoc"} }
+
+func (asciidocExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := readMarkup(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop comments and literal blocks, and replace {attribute} references
+	// by the values set in ":name: value" entries
+	var links linkSet
+	attributes := make(map[string]string)
+	var text, passthrough strings.Builder
+	delimiter := ""
+	literalParagraph, previousBlank := false, true
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		blank := trimmed == ""
+
+		if delimiter != "" {
+			if trimmed == delimiter && delimiter[0] == '+' {
+				// Passthrough blocks are raw HTML, read in document order
+				addAsciiDocInline(&links, text.String())
+				links.addHTML(passthrough.String())
+				text.Reset()
+				passthrough.Reset()
+				delimiter = ""
+			} else if trimmed == delimiter {
+				delimiter = ""
+			} else if delimiter[0] == '+' {
+				passthrough.WriteString(line + "\n")
+			} else if delimiter[0] != '/' && markdownOptions.CodeBlockLinks {
+				text.WriteString(line + "\n")
+			}
+			previousBlank = blank
+			continue
+		}
+
+		switch {
+		case isAsciiDocDelimiter(trimmed):
+			// Fenced code closes with ``` whatever its language
+			delimiter = trimmed
+			if strings.HasPrefix(trimmed, "```") {
+				delimiter = "```"
+			}
+		case strings.HasPrefix(trimmed, "//"):
+			// Line comment
+		case isAsciiDocAttributeEntry(trimmed):
+			name, value, _ := strings.Cut(trimmed[1:], ":")
+			if strings.HasSuffix(name, "!") {
+				delete(attributes, strings.TrimSuffix(name, "!"))
+			} else {
+				attributes[name] = substituteAttributes(strings.TrimSpace(value), attributes)
+			}
+		case blank:
+			literalParagraph = false
+			text.WriteString("\n")
+		case previousBlank && indentOf(line) > 0 && !isAsciiDocListItem(trimmed) || literalParagraph:
+			// An indented paragraph is literal
+			literalParagraph = true
+			if markdownOptions.CodeBlockLinks {
+				text.WriteString(line + "\n")
+			}
+		default:
+			text.WriteString(substituteAttributes(line, attributes) + "\n")
+		}
+		previousBlank = blank
+	}
+
+	addAsciiDocInline(&links, text.String())
+	return links.links, nil
+}
+
+// isAsciiDocDelimiter reports whether line opens or closes a listing
+// (----), literal (....), comment (////) or passthrough (++++) block, or a
+// fenced code block (```)
+func isAsciiDocDelimiter(line string) bool {
+	if strings.HasPrefix(line, "```") {
+		return strings.Trim(line, "`") == "" || !strings.Contains(line[3:], "`")
+	}
+	if len(line) < 4 || !strings.ContainsRune("-./+", rune(line[0])) {
+		return false
+	}
+	return strings.Trim(line, line[:1]) == ""
+}
+
+// isAsciiDocListItem reports whether line starts with a list marker such as
+// "*", "-", ".." or "1.", which may be indented without making it literal
+func isAsciiDocListItem(line string) bool {
+	marker, _, ok := strings.Cut(line, " ")
+	if !ok || marker == "" {
+		return false
+	}
+	if strings.Trim(marker, "*") == "" || strings.Trim(marker, ".") == "" || marker == "-" {
+		return true
+	}
+	digits := strings.TrimSuffix(marker, ".")
+	return len(digits) < len(marker) && strings.Trim(digits, "0123456789") == "" && digits != ""
+}
+
+// isAsciiDocAttributeEntry reports whether line is an attribute entry such
+// as ":base-url: https://example.com" or ":name!:"
+func isAsciiDocAttributeEntry(line string) bool {
+	if !strings.HasPrefix(line, ":") {
+		return false
+	}
+	name, _, ok := strings.Cut(line[1:], ":")
+	name = strings.TrimSuffix(name, "!")
+	if !ok || name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '-' || c == '_' || c < 128 && isASCIIAlnum(byte(c))) {
+			return false
+		}
+	}
+	return true
+}
+
+// substituteAttributes replaces {name} references to defined attributes
+func substituteAttributes(line string, attributes map[string]string) string {
+	if len(attributes) == 0 || !strings.Contains(line, "{") {
+		return line
+	}
+	for name, value := range attributes {
+		line = strings.ReplaceAll(line, "{"+name+"}", value)
+	}
+	return line
+}
+
+// asciidocMacros are the inline macros whose target is a link
+var asciidocMacros = []string{"link:", "image::", "image:", "video::", "audio::"}
+
+// addAsciiDocInline adds link and image macros, link:url[text] and
+// image:url[alt], and URLs with link text, https://url[text], then the plain
+// and angle-bracket URLs in the rest of the text
+func addAsciiDocInline(links *linkSet, text string) {
+	var rest strings.Builder
+	for i := 0; i < len(text); i++ {
+		// Macros start at a word boundary and are not escaped
+		if i > 0 && (isASCIIAlnum(text[i-1]) || text[i-1] == '\\') {
+			rest.WriteByte(text[i])
+			continue
+		}
+
+		prefix := ""
+		for _, macro := range asciidocMacros {
+			if strings.HasPrefix(text[i:], macro) {
+				prefix = macro
+				break
+			}
+		}
+		if prefix == "" && !hasPrefixFold(text[i:], "http://") && !hasPrefixFold(text[i:], "https://") {
+			rest.WriteByte(text[i])
+			continue
+		}
+
+		target, label, length, ok := parseAsciiDocMacro(text[i+len(prefix):])
+		if !ok {
+			rest.WriteByte(text[i])
+			continue
+		}
+		links.add(target, label)
+		rest.WriteString(" " + label + " ")
+		i += len(prefix) + length - 1
+	}
+
+	links.addText(rest.String())
+}
+
+// parseAsciiDocMacro parses "target[attributes]", where the target may be
+// wrapped in ++ passthrough marks, returning the target, the link text and
+// the length parsed
+func parseAsciiDocMacro(text string) (target, label string, length int, ok bool) {
+	var end int
+	if strings.HasPrefix(text, "++") {
+		closing := strings.Index(text[2:], "++")
+		if closing < 0 {
+			return "", "", 0, false
+		}
+		target, end = text[2:2+closing], closing+4
+	} else {
+		end = strings.IndexAny(text, "[ \t\n<>\"")
+		if end <= 0 {
+			return "", "", 0, false
+		}
+		target = text[:end]
+	}
+
+	if end >= len(text) || text[end] != '[' {
+		return "", "", 0, false
+	}
+	closing := strings.IndexByte(text[end:], ']')
+	if closing < 0 {
+		return "", "", 0, false
+	}
+	return target, asciidocLinkText(text[end+1 : end+closing]), end + closing + 1, true
+}
+
+// asciidocLinkText returns the text in a macro's attribute list: the first
+// positional attribute, quoted or not, without the "^" new-window mark
+func asciidocLinkText(attributes string) string {
+	attributes = strings.TrimSpace(attributes)
+	if strings.HasPrefix(attributes, `"`) {
+		if end := strings.Index(attributes[1:], `"`); end >= 0 {
+			return strings.TrimSpace(attributes[1 : end+1])
+		}
+	}
+	first, _, _ := strings.Cut(attributes, ",")
+	if strings.Contains(first, "=") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(first), "^"))
+}
+
+// readMarkup reads a text document with Unix line endings
+func readMarkup(r io.Reader) (string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return strings.ReplaceAll(string(content), "\r\n", "\n"), nil
+}
+
+// indentOf returns the width of a line's leading whitespace
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// indentedBlockEnd returns the index after the block that starts at lines[start]
+// and continues with blank lines and lines indented more than indent
+func indentedBlockEnd(lines []string, start, indent int) int {
+	end := start + 1
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if indentOf(lines[i]) <= indent {
+			break
+		}
+		end = i + 1
+	}
+	return end
+}
+
+// dedent removes the common leading whitespace of lines
+func dedent(lines []string) []string {
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if indent := indentOf(line); common < 0 || indent < common {
+			common = indent
+		}
+	}
+
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= common && common > 0 {
+			line = line[common:]
+		}
+		dedented[i] = strings.TrimRight(line, " \t")
+	}
+	return dedented
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
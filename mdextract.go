@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// MarkdownConfig is the JSON form of the Markdown extraction settings in config.json
+type MarkdownConfig struct {
+	CodeBlockLinks bool `json:"code_block_links"` // also take URLs from code blocks and code spans
+}
+
+// markdownOptions is the active Markdown configuration, set at startup
+var markdownOptions MarkdownConfig
+
+// markdownParser parses CommonMark; reference definitions are resolved by
+// the parser, so reference-style links arrive as ordinary link nodes
+var markdownParser = goldmark.New().Parser()
+
+// markdownExtractor finds links in Markdown documents
+type markdownExtractor struct{}
+
+func (markdownExtractor) Name() string         { return "markdown" }
+func (markdownExtractor) Extensions() []string { return []string{".md"} }
+func (markdownExtractor) MIMETypes() []string  { return []string{"text/markdown"} }
+
+func (markdownExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return parseMarkdownLinks(content), nil
+}
+
+// parseMarkdownLinks walks the CommonMark syntax tree of source and returns
+// every link destination with its text: inline, reference-style and image
+// links, autolinks, links in raw HTML, and plain URLs in the text. URLs in
+// code are only included with markdown.code_block_links.
+func parseMarkdownLinks(source []byte) []Link {
+	var links linkSet
+	document := markdownParser.Parse(text.NewReader(source))
+
+	// The inline parser splits text at characters such as "_" and "&", so
+	// adjacent text is gathered and searched for plain URLs as a whole
+	var pending strings.Builder
+	flush := func() {
+		links.addText(pending.String())
+		pending.Reset()
+	}
+
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node.(type) {
+		case *ast.Text, *ast.String, *ast.Emphasis:
+		default:
+			flush()
+		}
+
+		switch n := node.(type) {
+		case *ast.Link:
+			links.add(string(n.Destination), markdownText(n, source))
+			return ast.WalkSkipChildren, nil
+
+		case *ast.Image:
+			links.add(string(n.Destination), markdownText(n, source))
+			return ast.WalkSkipChildren, nil
+
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL {
+				links.add(string(n.URL(source)), "")
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.HTMLBlock:
+			links.addHTML(markdownLines(n.Lines(), source))
+			return ast.WalkSkipChildren, nil
+
+		case *ast.RawHTML:
+			links.addHTML(markdownLines(n.Segments, source))
+			return ast.WalkSkipChildren, nil
+
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			if markdownOptions.CodeBlockLinks {
+				links.addText(markdownLines(n.Lines(), source))
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.CodeSpan:
+			if markdownOptions.CodeBlockLinks {
+				links.addText(markdownText(n, source))
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.Text:
+			pending.Write(n.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				pending.WriteByte('\n')
+			}
+
+		case *ast.String:
+			pending.Write(n.Value)
+		}
+
+		return ast.WalkContinue, nil
+	})
+	flush()
+
+	return links.links
+}
+
+// markdownText returns the plain text of node's inline content
+func markdownText(node ast.Node, source []byte) string {
+	var buf strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := n.(type) {
+		case *ast.Text:
+			buf.Write(t.Value(source))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+// markdownLines joins the source text of a block's line segments
+func markdownLines(lines *text.Segments, source []byte) string {
+	var buf bytes.Buffer
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(source))
+	}
+	return buf.String()
+}
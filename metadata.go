@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MetadataConfig is the JSON form of the provenance settings in config.json
+type MetadataConfig struct {
+	Sidecar bool `json:"sidecar"` // write <file>.meta.json next to each download
+	Xattr   bool `json:"xattr"`   // set the user.xdg.origin.url extended attribute (Linux only)
+}
+
+// provenance is the active metadata configuration, set at startup
+var provenance MetadataConfig
+
+// sidecarSuffix is appended to a downloaded file's name to name its sidecar
+const sidecarSuffix = ".meta.json"
+
+// downloadMetadata is the content of a sidecar file
+type downloadMetadata struct {
+	URL              string     `json:"url"`
+	FinalURL         string     `json:"final_url"`
+	RedirectChain    []string   `json:"redirect_chain,omitempty"`
+	SourceFile       string     `json:"source_file"`
+	DownloadedAt     time.Time  `json:"downloaded_at"`
+	HTTPStatus       int        `json:"http_status"`
+	ETag             string     `json:"etag,omitempty"`
+	ContentType      string     `json:"content_type,omitempty"`
+	LastModified     *time.Time `json:"last_modified,omitempty"`
+	Size             int64      `json:"size"`
+	SHA256           string     `json:"sha256"`
+	ArchiveURL       string     `json:"archive_url,omitempty"`
+	ArchiveTimestamp *time.Time `json:"archive_timestamp,omitempty"`
+	EmailSubject     string     `json:"email_subject,omitempty"`
+}
+
+// recordProvenance writes the sidecar and extended attribute enabled in the
+// config for a successful download of link, found in sourceFile. URLs are
+// redacted so credentials never end up on disk.
+func recordProvenance(sourceFile string, link Link, result DownloadResult) error {
+	var errs []error
+
+	if provenance.Sidecar {
+		if err := writeSidecar(sourceFile, link, result); err != nil {
+			errs = append(errs, fmt.Errorf("sidecar: %w", err))
+		}
+	}
+
+	// Filesystems and platforms without extended attributes are skipped quietly
+	if provenance.Xattr {
+		if err := setOriginURL(result.FilePath, redact(result.URL)); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			errs = append(errs, fmt.Errorf("xattr: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeSidecar writes <file>.meta.json describing result
+func writeSidecar(sourceFile string, link Link, result DownloadResult) error {
+	meta := downloadMetadata{
+		URL:          redact(result.URL),
+		FinalURL:     redact(result.FinalURL),
+		SourceFile:   sourceFile,
+		DownloadedAt: result.DownloadedAt,
+		HTTPStatus:   result.StatusCode,
+		ETag:         result.ETag,
+		ContentType:  result.ContentType,
+		Size:         result.BytesWritten,
+		SHA256:       result.SHA256,
+		EmailSubject: link.Subject,
+	}
+	if !result.LastModified.IsZero() {
+		meta.LastModified = &result.LastModified
+	}
+	for _, hop := range result.RedirectChain {
+		meta.RedirectChain = append(meta.RedirectChain, redact(hop))
+	}
+	if result.RecoveredFromArchive {
+		meta.ArchiveURL = result.ArchiveURL
+		meta.ArchiveTimestamp = &result.ArchiveTimestamp
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(result.FilePath+sidecarSuffix, append(data, '\n'), 0644)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// filenameFields are the placeholders a filename template may use
+var filenameFields = []string{"name", "title", "subject"}
+
+// filenameFieldPattern matches a {field} placeholder
+var filenameFieldPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// filenameTemplate names downloads from their link, set from config.json at
+// startup; empty keeps the name from the URL or Content-Disposition
+var filenameTemplate string
+
+// templatedPaths records the link each templated file path was given to
+// during the run, so that links sharing a title or subject get distinct names
+var templatedPaths = struct {
+	sync.Mutex
+	owners map[string]string
+}{owners: make(map[string]string)}
+
+// parseFilenameTemplate checks that a template only uses known placeholders
+func parseFilenameTemplate(template string) (string, error) {
+	template = strings.TrimSpace(template)
+	for _, match := range filenameFieldPattern.FindAllStringSubmatch(template, -1) {
+		if !isFilenameField(match[1]) {
+			return "", fmt.Errorf("filename_template: unknown placeholder {%s} (expected {%s})", match[1], strings.Join(filenameFields, "}, {"))
+		}
+	}
+	return template, nil
+}
+
+// isFilenameField reports whether field is a known placeholder name
+func isFilenameField(field string) bool {
+	for _, known := range filenameFields {
+		if field == known {
+			return true
+		}
+	}
+	return false
+}
+
+// linkFilename renames filename with the filename template, keeping its
+// extension. {name} is filename without its extension, {title} the link's
+// text (such as a feed item or CSV title) and {subject} the subject of the
+// email it came from. Links missing a field the template uses keep filename.
+func linkFilename(filename string, link Link) string {
+	if filenameTemplate == "" {
+		return filename
+	}
+
+	ext := path.Ext(filename)
+	missing := false
+	name := filenameFieldPattern.ReplaceAllStringFunc(filenameTemplate, func(placeholder string) string {
+		var value string
+		switch strings.Trim(placeholder, "{}") {
+		case "name":
+			value = strings.TrimSuffix(filename, ext)
+		case "title":
+			value = link.Text
+		case "subject":
+			value = link.Subject
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		if value == "" {
+			missing = true
+		}
+		return value
+	})
+	if missing {
+		return filename
+	}
+
+	// A title of only dots or separators sanitises to nothing
+	if name = sanitizeFilename(name); name == "" {
+		return filename
+	}
+	return sanitizeFilename(name + ext)
+}
+
+// linkFilePath returns the path in dir for filename renamed by the filename
+// template. A templated name already given to another link in this run gets
+// " ({name})" appended, and then a counter, so that every link from one email
+// or feed item is downloaded. A name left by an earlier run is reused, so the
+// download is skipped as already existing.
+func linkFilePath(dir, filename string, link Link) string {
+	named := linkFilename(filename, link)
+	if named == filename {
+		return filepath.Join(dir, filename)
+	}
+
+	ext := path.Ext(named)
+	base := strings.TrimSuffix(named, ext)
+	suffix := ""
+	if !strings.Contains(filenameTemplate, "{name}") {
+		if name := strings.TrimSuffix(filename, path.Ext(filename)); name != "" {
+			suffix = " (" + name + ")"
+		}
+	}
+
+	templatedPaths.Lock()
+	defer templatedPaths.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		var candidate string
+		switch {
+		case attempt == 1:
+			candidate = named
+		case suffix != "" && attempt == 2:
+			candidate = sanitizeFilename(base + suffix + ext)
+		default:
+			candidate = sanitizeFilename(base + suffix + " " + strconv.Itoa(attempt) + ext)
+		}
+
+		filePath := filepath.Join(dir, candidate)
+		if owner, taken := templatedPaths.owners[filePath]; !taken || owner == link.URL {
+			templatedPaths.owners[filePath] = link.URL
+			return filePath
+		}
+	}
+}
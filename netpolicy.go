@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// NetworkConfig is the JSON form of the outbound network policy in config.json
+type NetworkConfig struct {
+	AllowCIDRs           []string `json:"allow_cidrs"`            // always permitted, even if denied below
+	DenyCIDRs            []string `json:"deny_cidrs"`             // blocked in addition to the defaults
+	AllowPrivateNetworks bool     `json:"allow_private_networks"` // drop the default private/loopback deny list
+}
+
+// defaultDeniedCIDRs are loopback, private, link-local and other non-public
+// ranges that links found in untrusted files must not reach
+var defaultDeniedCIDRs = []string{
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, including cloud metadata endpoints
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved and broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+	"64:ff9b:1::/48", // local-use NAT64
+}
+
+// networkPolicy decides which resolved IP addresses may be connected to.
+// It is enforced in the dialer, after DNS resolution, for every connection
+// including those made while following redirects.
+type networkPolicy struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// proxyDialKey is the context key of a request's proxyDial
+type proxyDialKey struct{}
+
+// trustedDialKey is the context key of a host:port the user configured,
+// such as the Wayback endpoint, that a request may connect to regardless of
+// the policy
+type trustedDialKey struct{}
+
+// withTrustedEndpoint returns ctx allowing requests made with it to connect
+// to endpoint's host and port even if the policy denies its address, so that
+// a configured service may run on a private network or loopback. Other
+// hosts, including redirect targets, are still checked.
+func withTrustedEndpoint(ctx context.Context, endpoint *url.URL) context.Context {
+	return context.WithValue(ctx, trustedDialKey{}, dialAddr(endpoint))
+}
+
+// proxyDial records the host:port of the proxy chosen for one request. Only
+// the transport's connection to that proxy skips the policy check, so a link
+// naming the proxy's address directly is still checked.
+type proxyDial struct {
+	addr atomic.Pointer[string]
+}
+
+// newNetworkPolicy parses a NetworkConfig
+func newNetworkPolicy(cfg NetworkConfig) (*networkPolicy, error) {
+	policy := &networkPolicy{}
+
+	var err error
+	if policy.allow, err = parsePrefixes(cfg.AllowCIDRs); err != nil {
+		return nil, fmt.Errorf("network.allow_cidrs: %w", err)
+	}
+
+	deny := cfg.DenyCIDRs
+	if !cfg.AllowPrivateNetworks {
+		deny = append(append([]string{}, defaultDeniedCIDRs...), deny...)
+	}
+	if policy.deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("network.deny_cidrs: %w", err)
+	}
+
+	return policy, nil
+}
+
+// parsePrefixes parses CIDRs; a bare address is treated as a single host
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// checkAddr returns an error if the policy forbids connecting to addr
+func (p *networkPolicy) checkAddr(addr netip.Addr) error {
+	// Treat IPv4-mapped IPv6 addresses as the IPv4 address they carry
+	addr = addr.Unmap()
+
+	for _, prefix := range p.allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	for _, prefix := range p.deny {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("connection to %s blocked by network policy (%s)", addr, prefix)
+		}
+	}
+	return nil
+}
+
+// control is a net.Dialer Control function that checks the resolved address
+// of each connection attempt
+func (p *networkPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("network policy: unexpected dial address %q", address)
+	}
+	return p.checkAddr(addr)
+}
+
+// dialContext returns a DialContext function that enforces the policy for
+// every address except the proxy chosen for the request being dialed and a
+// trusted endpoint the request was made for
+func (p *networkPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = p.control
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if trusted, ok := ctx.Value(trustedDialKey{}).(string); ok && trusted == addr {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if dial, ok := ctx.Value(proxyDialKey{}).(*proxyDial); ok {
+			if proxyAddr := dial.addr.Load(); proxyAddr != nil && *proxyAddr == addr {
+				return dialer.DialContext(ctx, network, addr)
+			}
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+}
+
+// wrapProxy records the proxy chosen by proxy as the request's trusted dial
+// target. Because the proxy resolves and connects to the target itself, the
+// target host is resolved locally and checked first as a best effort.
+func (p *networkPolicy) wrapProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+
+		if err := p.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+
+		if dial, ok := req.Context().Value(proxyDialKey{}).(*proxyDial); ok {
+			addr := dialAddr(proxyURL)
+			dial.addr.Store(&addr)
+		}
+		return proxyURL, nil
+	}
+}
+
+// proxyDialTransport gives each request, including every redirect hop, its
+// own proxyDial for wrapProxy to fill in and dialContext to read
+type proxyDialTransport struct {
+	base http.RoundTripper
+}
+
+func (t *proxyDialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), proxyDialKey{}, &proxyDial{})
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
+
+// checkHost resolves host and checks every address it resolves to
+func (p *networkPolicy) checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		// Leave resolution failures to the proxy
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := p.checkAddr(addr); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// dialAddr returns the host:port the transport dials for a server or proxy URL
+func dialAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
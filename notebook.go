@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// notebookText is a notebook string field, stored either as one string or
+// as a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+	return nil
+}
+
+// notebookOutput is a cell output; rich outputs hold one rendering per
+// media type
+type notebookOutput struct {
+	OutputType string                     `json:"output_type"`
+	Text       notebookText               `json:"text"`
+	Data       map[string]json.RawMessage `json:"data"`
+}
+
+// data returns the rendering of the output as mediaType, if it has one
+func (o notebookOutput) data(mediaType string) (string, bool) {
+	raw, ok := o.Data[mediaType]
+	if !ok {
+		return "", false
+	}
+	var text notebookText
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return "", false
+	}
+	return string(text), true
+}
+
+// notebookExtractor reads Jupyter notebooks (nbformat 4)
+type notebookExtractor struct{}
+
+func (notebookExtractor) Name() string         { return "notebook" }
+func (notebookExtractor) Extensions() []string { return []string{".ipynb"} }
+func (notebookExtractor) MIMETypes() []string  { return []string{"application/x-ipynb+json"} }
+
+func (notebookExtractor) Extract(r io.Reader) ([]Link, error) {
+	var notebook struct {
+		Cells []struct {
+			CellType string           `json:"cell_type"`
+			Source   notebookText     `json:"source"`
+			Outputs  []notebookOutput `json:"outputs"`
+		} `json:"cells"`
+	}
+	if err := json.NewDecoder(r).Decode(&notebook); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+
+	// Markdown cells are parsed like .md files; code cells are code blocks
+	var links linkSet
+	for _, cell := range notebook.Cells {
+		switch cell.CellType {
+		case "markdown":
+			for _, link := range parseMarkdownLinks([]byte(cell.Source)) {
+				links.addLink(link)
+			}
+		case "code":
+			if markdownOptions.CodeBlockLinks {
+				links.addText(string(cell.Source))
+			}
+		case "raw":
+			links.addText(string(cell.Source))
+		}
+
+		for _, output := range cell.Outputs {
+			addNotebookOutputLinks(&links, output)
+		}
+	}
+
+	return links.links, nil
+}
+
+// addNotebookOutputLinks adds the links in a cell output, taking the richest
+// rendering of rich outputs. Tracebacks are skipped.
+func addNotebookOutputLinks(links *linkSet, output notebookOutput) {
+	switch output.OutputType {
+	case "stream":
+		links.addText(string(output.Text))
+	case "execute_result", "display_data", "update_display_data":
+		if html, ok := output.data("text/html"); ok {
+			links.addHTML(html)
+		} else if markdown, ok := output.data("text/markdown"); ok {
+			for _, link := range parseMarkdownLinks([]byte(markdown)) {
+				links.addLink(link)
+			}
+		} else if plain, ok := output.data("text/plain"); ok {
+			links.addText(plain)
+		}
+	}
+}
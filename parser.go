@@ -3,70 +3,80 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"os"
-	"path/filepath"
-	"regexp"
+	"io"
+	"net/url"
 	"strings"
 )
 
-// URL patterns for regex extraction
-var (
-	// Match http:// and https:// URLs
-	urlPattern = regexp.MustCompile(`https?://[^\s<>"{}|\\^\[\]` + "`" + `()]+`)
+// Link is a URL found in a file, with the text it was given there, if any
+type Link struct {
+	URL     string
+	Text    string
+	Folder  []string // bookmark folders containing the link, outermost first
+	Subject string   // subject of the email containing the link
+}
 
-	// Match markdown links: [text](url)
-	markdownLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+// linkSet collects valid links in the order they were found, without duplicates
+type linkSet struct {
+	links []Link
+	seen  map[string]bool
+}
 
-	// Match HTML href and src attributes
-	htmlHrefPattern = regexp.MustCompile(`(?i)href=["']([^"']+)["']`)
-	htmlSrcPattern  = regexp.MustCompile(`(?i)src=["']([^"']+)["']`)
-)
+// add records rawURL if it is valid and not yet in the set
+func (s *linkSet) add(rawURL, text string) {
+	s.addLink(Link{URL: rawURL, Text: text})
+}
 
-// extractURLsFromFile extracts URLs from a file based on its extension
-func extractURLsFromFile(filePath string) ([]string, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
-
-	switch ext {
-	case ".url":
-		return extractURLsFromURLFile(filePath)
-	case ".md":
-		return extractURLsFromMarkdown(filePath)
-	case ".html", ".htm":
-		return extractURLsFromHTML(filePath)
-	case ".txt":
-		return extractURLsFromText(filePath)
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
+// addLink records link if its URL is valid and not yet in the set
+func (s *linkSet) addLink(link Link) {
+	link.URL = strings.TrimSpace(link.URL)
+	if s.seen[link.URL] || !isValidURL(link.URL) {
+		return
 	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[link.URL] = true
+	s.links = append(s.links, link)
 }
 
-// extractURLsFromURLFile parses Windows .url files (INI format)
-func extractURLsFromURLFile(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+// addText records the plain URLs in text
+func (s *linkSet) addText(text string) {
+	for _, url := range findURLs(text) {
+		s.add(url, "")
 	}
-	defer file.Close()
+}
+
+// addHTML records the absolute links in an HTML fragment
+func (s *linkSet) addHTML(fragment string) {
+	urls, _ := parseHTMLLinks(strings.NewReader(fragment))
+	for _, url := range urls {
+		s.add(url, "")
+	}
+}
+
+// urlFileExtractor parses Windows .url shortcuts and Internet Explorer
+// .website pinned sites (INI format)
+type urlFileExtractor struct{}
+
+func (urlFileExtractor) Name() string         { return "url" }
+func (urlFileExtractor) Extensions() []string { return []string{".url", ".website"} }
+func (urlFileExtractor) MIMETypes() []string {
+	return []string{"application/x-mswinurl", "application/internet-shortcut"}
+}
 
-	var urls []string
-	scanner := bufio.NewScanner(file)
+func (urlFileExtractor) Extract(r io.Reader) ([]Link, error) {
+	var links linkSet
+	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
 		// Look for URL= or BaseURL= lines
 		if strings.HasPrefix(line, "URL=") {
-			url := strings.TrimPrefix(line, "URL=")
-			url = strings.TrimSpace(url)
-			if url != "" && isValidURL(url) {
-				urls = append(urls, url)
-			}
+			links.add(strings.TrimPrefix(line, "URL="), "")
 		} else if strings.HasPrefix(line, "BaseURL=") {
-			url := strings.TrimPrefix(line, "BaseURL=")
-			url = strings.TrimSpace(url)
-			if url != "" && isValidURL(url) {
-				urls = append(urls, url)
-			}
+			links.add(strings.TrimPrefix(line, "BaseURL="), "")
 		}
 	}
 
@@ -74,146 +84,56 @@ func extractURLsFromURLFile(filePath string) ([]string, error) {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
-	return urls, nil
+	return links.links, nil
 }
 
-// extractURLsFromMarkdown extracts URLs from markdown files
-func extractURLsFromMarkdown(filePath string) ([]string, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
+// textExtractor finds plain URLs in text files
+type textExtractor struct{}
 
-	text := string(content)
-	urlMap := make(map[string]bool) // Use map to avoid duplicates
-
-	// Extract markdown links [text](url)
-	markdownMatches := markdownLinkPattern.FindAllStringSubmatch(text, -1)
-	for _, match := range markdownMatches {
-		if len(match) >= 3 {
-			url := strings.TrimSpace(match[2])
-			if isValidURL(url) {
-				urlMap[url] = true
-			}
-		}
-	}
+func (textExtractor) Name() string         { return "text" }
+func (textExtractor) Extensions() []string { return []string{".txt"} }
+func (textExtractor) MIMETypes() []string  { return []string{"text/plain"} }
 
-	// Extract plain URLs
-	plainURLs := urlPattern.FindAllString(text, -1)
-	for _, url := range plainURLs {
-		url = strings.TrimSpace(url)
-		if isValidURL(url) {
-			urlMap[url] = true
-		}
-	}
-
-	// Convert map to slice
-	urls := make([]string, 0, len(urlMap))
-	for url := range urlMap {
-		urls = append(urls, url)
-	}
-
-	return urls, nil
-}
-
-// extractURLsFromHTML extracts URLs from HTML files
-func extractURLsFromHTML(filePath string) ([]string, error) {
-	content, err := os.ReadFile(filePath)
+func (textExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	text := string(content)
-	urlMap := make(map[string]bool) // Use map to avoid duplicates
-
-	// Extract href attributes
-	hrefMatches := htmlHrefPattern.FindAllStringSubmatch(text, -1)
-	for _, match := range hrefMatches {
-		if len(match) >= 2 {
-			url := strings.TrimSpace(match[1])
-			if isValidURL(url) {
-				urlMap[url] = true
-			}
-		}
-	}
-
-	// Extract src attributes
-	srcMatches := htmlSrcPattern.FindAllStringSubmatch(text, -1)
-	for _, match := range srcMatches {
-		if len(match) >= 2 {
-			url := strings.TrimSpace(match[1])
-			if isValidURL(url) {
-				urlMap[url] = true
-			}
-		}
-	}
-
-	// Extract plain URLs
-	plainURLs := urlPattern.FindAllString(text, -1)
-	for _, url := range plainURLs {
-		url = strings.TrimSpace(url)
-		if isValidURL(url) {
-			urlMap[url] = true
-		}
-	}
+	var links linkSet
+	links.addText(string(content))
 
-	// Convert map to slice
-	urls := make([]string, 0, len(urlMap))
-	for url := range urlMap {
-		urls = append(urls, url)
-	}
-
-	return urls, nil
+	return links.links, nil
 }
 
-// extractURLsFromText extracts URLs from plain text files using regex
-func extractURLsFromText(filePath string) ([]string, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	text := string(content)
-	urlMap := make(map[string]bool) // Use map to avoid duplicates
+// placeholderHosts are documentation domains that never host real files
+var placeholderHosts = []string{"example.com", "example.org", "example.net"}
 
-	// Extract all URLs
-	matches := urlPattern.FindAllString(text, -1)
-	for _, url := range matches {
-		url = strings.TrimSpace(url)
-		if isValidURL(url) {
-			urlMap[url] = true
-		}
-	}
-
-	// Convert map to slice
-	urls := make([]string, 0, len(urlMap))
-	for url := range urlMap {
-		urls = append(urls, url)
-	}
-
-	return urls, nil
-}
-
-// isValidURL performs basic validation on a URL string
-func isValidURL(url string) bool {
+// isValidURL performs basic validation on a URL string. Whether the host may
+// be contacted is decided later by the network policy, on resolved addresses.
+func isValidURL(rawURL string) bool {
 	// Must start with http:// or https://
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
 		return false
 	}
 
 	// Must have more than just the protocol
-	if len(url) < 10 {
+	if len(rawURL) < 10 {
 		return false
 	}
 
-	// Filter out common false positives
-	lowerURL := strings.ToLower(url)
-	if strings.Contains(lowerURL, "example.com") ||
-		strings.Contains(lowerURL, "example.org") ||
-		strings.Contains(lowerURL, "localhost") ||
-		strings.Contains(lowerURL, "127.0.0.1") {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Hostname() == "" {
 		return false
 	}
 
+	// Filter out common false positives
+	host := strings.ToLower(parsedURL.Hostname())
+	for _, placeholder := range placeholderHosts {
+		if host == placeholder || strings.HasSuffix(host, "."+placeholder) {
+			return false
+		}
+	}
+
 	return true
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ProxyConfig is the JSON form of the proxy settings in config.json
+type ProxyConfig struct {
+	Default string            `json:"default"`
+	Rules   []ProxyRuleConfig `json:"rules"`
+}
+
+// ProxyRuleConfig routes hosts matching any of Hosts through Proxy.
+// Proxy is a URL (http://, https://, socks5://, socks5h://) or "direct".
+type ProxyRuleConfig struct {
+	Hosts []string `json:"hosts"`
+	Proxy string   `json:"proxy"`
+}
+
+// proxyRule is a parsed ProxyRuleConfig; a nil proxy means a direct connection
+type proxyRule struct {
+	hosts []string
+	proxy *url.URL
+}
+
+// proxySelector picks the proxy for each request from per-host rules, the
+// configured default, or the standard proxy environment variables
+type proxySelector struct {
+	rules      []proxyRule
+	defaultURL *url.URL
+	direct     bool // default is "direct"
+}
+
+// newProxySelector parses a ProxyConfig
+func newProxySelector(cfg ProxyConfig) (*proxySelector, error) {
+	selector := &proxySelector{}
+
+	if cfg.Default != "" {
+		proxyURL, err := parseProxyURL(cfg.Default)
+		if err != nil {
+			return nil, fmt.Errorf("proxy.default: %w", err)
+		}
+		selector.defaultURL = proxyURL
+		selector.direct = proxyURL == nil
+	}
+
+	for i, ruleCfg := range cfg.Rules {
+		proxyURL, err := parseProxyURL(ruleCfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy.rules[%d]: %w", i, err)
+		}
+		if len(ruleCfg.Hosts) == 0 {
+			return nil, fmt.Errorf("proxy.rules[%d]: no hosts given", i)
+		}
+		selector.rules = append(selector.rules, proxyRule{
+			hosts: normalizeList(ruleCfg.Hosts, false),
+			proxy: proxyURL,
+		})
+	}
+
+	return selector, nil
+}
+
+// parseProxyURL parses a proxy URL, returning nil for "direct"
+func parseProxyURL(value string) (*url.URL, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "direct") {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q", redact(value))
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme in %q (expected http, https, socks5 or socks5h)", redact(value))
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", redact(value))
+	}
+	if password, ok := proxyURL.User.Password(); ok {
+		registerSecret(password)
+	}
+
+	return proxyURL, nil
+}
+
+// Proxy implements http.Transport.Proxy
+func (s *proxySelector) Proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+
+	for _, rule := range s.rules {
+		for _, pattern := range rule.hosts {
+			if matchHostPattern(pattern, host) {
+				return rule.proxy, nil
+			}
+		}
+	}
+
+	if s.direct {
+		return nil, nil
+	}
+	if s.defaultURL != nil {
+		return s.defaultURL, nil
+	}
+
+	// Fall back to HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	return http.ProxyFromEnvironment(req)
+}
+
+// matchHostPattern matches a lowercase host against a pattern such as
+// "example.com", "*.internal" or "files-??.example.net"
+func matchHostPattern(pattern, host string) bool {
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	matched, err := path.Match(pattern, host)
+	return err == nil && matched
+}
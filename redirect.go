@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RedirectConfig is the JSON form of the redirect policy in config.json
+type RedirectConfig struct {
+	Max            int      `json:"max"`             // maximum redirects per request (default 10, negative for none)
+	AllowDowngrade bool     `json:"allow_downgrade"` // permit HTTPS to HTTP redirects
+	CrossHost      string   `json:"cross_host"`      // "allow" (default), "same-site" or "deny"
+	AllowedHosts   []string `json:"allowed_hosts"`   // targets always permitted
+}
+
+// Cross-host redirect modes
+const (
+	crossHostAllow    = "allow"
+	crossHostSameSite = "same-site"
+	crossHostDeny     = "deny"
+)
+
+// defaultMaxRedirects matches the Go client's default limit
+const defaultMaxRedirects = 10
+
+// redirectPolicy implements http.Client.CheckRedirect
+type redirectPolicy struct {
+	max            int
+	allowDowngrade bool
+	crossHost      string
+	allowedHosts   []string
+}
+
+// newRedirectPolicy parses a RedirectConfig
+func newRedirectPolicy(cfg RedirectConfig) (*redirectPolicy, error) {
+	policy := &redirectPolicy{
+		max:            cfg.Max,
+		allowDowngrade: cfg.AllowDowngrade,
+		crossHost:      strings.ToLower(strings.TrimSpace(cfg.CrossHost)),
+		allowedHosts:   normalizeList(cfg.AllowedHosts, false),
+	}
+
+	// 0 keeps the default; a negative value disables redirects
+	if policy.max == 0 {
+		policy.max = defaultMaxRedirects
+	}
+	if policy.max < 0 {
+		policy.max = 0
+	}
+
+	switch policy.crossHost {
+	case "":
+		policy.crossHost = crossHostAllow
+	case crossHostAllow, crossHostSameSite, crossHostDeny:
+	default:
+		return nil, fmt.Errorf("redirects.cross_host: unknown mode %q (expected allow, same-site or deny)", cfg.CrossHost)
+	}
+
+	return policy, nil
+}
+
+// check is called before following each redirect; via holds the requests
+// made so far, oldest first
+func (p *redirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if len(via) > p.max {
+		return fmt.Errorf("stopped after %d redirects", p.max)
+	}
+
+	previous := via[len(via)-1]
+	if !p.allowDowngrade && previous.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refused redirect from HTTPS to %s", redact(req.URL.String()))
+	}
+
+	originalHost := strings.ToLower(via[0].URL.Hostname())
+	targetHost := strings.ToLower(req.URL.Hostname())
+	if targetHost == originalHost || matchAnyHost(p.allowedHosts, targetHost) {
+		return nil
+	}
+
+	switch p.crossHost {
+	case crossHostDeny:
+		return fmt.Errorf("refused cross-host redirect from %s to %s", originalHost, redact(req.URL.String()))
+	case crossHostSameSite:
+		if registrableDomain(originalHost) != registrableDomain(targetHost) {
+			return fmt.Errorf("refused cross-site redirect from %s to %s", originalHost, redact(req.URL.String()))
+		}
+	}
+
+	return nil
+}
+
+// registrableDomain returns the eTLD+1 of host (e.g. "github.com" for
+// "codeload.github.com"), or host itself if it has none
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// recordRedirects stores the final URL of resp, and the redirect chain that
+// led to it, in result. Each redirect request carries the response that
+// caused it, so the chain is rebuilt by walking back from the final request.
+func recordRedirects(resp *http.Response, result *DownloadResult) {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+
+	result.FinalURL = chain[len(chain)-1]
+	if len(chain) > 1 {
+		result.RedirectChain = chain
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FilenameProfile selects the set of filename rules applied by sanitizeFilename
+type FilenameProfile string
+
+const (
+	// ProfileWindows produces names valid on NTFS/FAT under Windows
+	ProfileWindows FilenameProfile = "windows"
+	// ProfilePOSIX produces names valid on Linux/macOS filesystems
+	ProfilePOSIX FilenameProfile = "posix"
+	// ProfilePortable produces names valid everywhere (union of all rules)
+	ProfilePortable FilenameProfile = "portable"
+)
+
+// maxFilenameBytes is the maximum length of a generated filename in bytes.
+// Most filesystems allow 255 bytes; we stay below that to leave room for
+// the Windows 260 character path limit and for suffixes added later.
+const maxFilenameBytes = 200
+
+// filenameProfile is the active profile, set from config.json at startup
+var filenameProfile = ProfilePortable
+
+// windowsReservedNames are device names that cannot be used as a file's base
+// name on Windows, regardless of extension (e.g. "CON.txt" is also reserved)
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// parseFilenameProfile validates a profile name from configuration
+func parseFilenameProfile(name string) (FilenameProfile, error) {
+	switch FilenameProfile(strings.ToLower(strings.TrimSpace(name))) {
+	case "", ProfilePortable:
+		return ProfilePortable, nil
+	case ProfileWindows:
+		return ProfileWindows, nil
+	case ProfilePOSIX:
+		return ProfilePOSIX, nil
+	default:
+		return "", fmt.Errorf("unknown filename profile %q (expected windows, posix or portable)", name)
+	}
+}
+
+// sanitizeFilename makes a filename safe for the active filename profile
+func sanitizeFilename(filename string) string {
+	return sanitizeFilenameFor(filename, filenameProfile)
+}
+
+// sanitizeFilenameFor makes a filename safe for the given profile
+func sanitizeFilenameFor(filename string, profile FilenameProfile) string {
+	windowsRules := profile != ProfilePOSIX
+
+	// Normalize to NFC so the same name composed differently (e.g. macOS NFD)
+	// maps to the same file, and drop invalid UTF-8 sequences
+	filename = strings.ToValidUTF8(filename, "_")
+	filename = norm.NFC.String(filename)
+
+	// Replace control characters and characters invalid for the profile
+	filename = strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 || unicode.IsControl(r) {
+			return '_'
+		}
+		if windowsRules && strings.ContainsRune(`<>:"\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	// Remove leading spaces and dots (avoids hidden files and "..")
+	filename = strings.TrimLeft(filename, " .")
+	filename = trimFilenameEnd(filename, windowsRules)
+
+	// Limit filename length without splitting multi-byte characters
+	if len(filename) > maxFilenameBytes {
+		ext := filepath.Ext(filename)
+		if len(ext) > maxFilenameBytes/4 {
+			ext = ""
+		}
+		base := truncateUTF8(strings.TrimSuffix(filename, ext), maxFilenameBytes-len(ext))
+		filename = trimFilenameEnd(base, windowsRules) + ext
+	}
+
+	// Escape Windows device names such as CON or COM1.txt
+	if windowsRules {
+		filename = escapeReservedName(filename)
+	}
+
+	return filename
+}
+
+// trimFilenameEnd removes trailing spaces, and trailing dots where Windows
+// would silently strip them
+func trimFilenameEnd(filename string, windowsRules bool) string {
+	if windowsRules {
+		return strings.TrimRight(filename, " .")
+	}
+	return strings.TrimRight(filename, " ")
+}
+
+// truncateUTF8 shortens s to at most maxBytes without splitting a rune
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
+// escapeReservedName appends an underscore to the base name of a Windows
+// reserved device name, keeping any extension intact
+func escapeReservedName(filename string) string {
+	base, rest := filename, ""
+	if idx := strings.Index(filename, "."); idx != -1 {
+		base, rest = filename[:idx], filename[idx:]
+	}
+
+	if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return base + "_" + rest
+	}
+	return filename
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -11,31 +12,23 @@ import (
 	"github.com/schollz/progressbar/v3"
 )
 
-// Supported file extensions for scanning
-var supportedExtensions = map[string]bool{
-	".url":  true,
-	".md":   true,
-	".html": true,
-	".htm":  true,
-	".txt":  true,
-}
-
-// scanDirectoryWithBatches scans a directory and processes subdirectories in batches
-func scanDirectoryWithBatches(rootDir string, recursive bool, jobs chan<- string, stats *Stats) {
+// scanDirectoryWithBatches scans a directory and processes subdirectories in batches.
+// Scanning stops early when ctx is cancelled.
+func scanDirectoryWithBatches(ctx context.Context, rootDir string, recursive bool, jobs chan<- string, stats *Stats) {
 	if recursive {
 		// Get all subdirectories
 		subdirs, err := getSubdirectories(rootDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to get subdirectories of %s: %v\n", rootDir, err)
 			// Fall back to scanning root directory only
-			scanDirectory(rootDir, false, jobs, stats)
+			scanDirectory(ctx, rootDir, false, jobs, stats)
 			return
 		}
 
 		// If no subdirectories found, just scan the root directory
 		if len(subdirs) == 0 {
 			fmt.Printf("No subdirectories found in %s, scanning root directory only\n", rootDir)
-			scanDirectory(rootDir, false, jobs, stats)
+			scanDirectory(ctx, rootDir, false, jobs, stats)
 			return
 		}
 
@@ -65,7 +58,7 @@ func scanDirectoryWithBatches(rootDir string, recursive bool, jobs chan<- string
 		)
 
 		// Process subdirectories in batches
-		for i := 0; i < len(subdirs); i += batchSize {
+		for i := 0; i < len(subdirs) && ctx.Err() == nil; i += batchSize {
 			end := i + batchSize
 			if end > len(subdirs) {
 				end = len(subdirs)
@@ -75,20 +68,25 @@ func scanDirectoryWithBatches(rootDir string, recursive bool, jobs chan<- string
 
 			// Process each directory in the batch
 			for _, dir := range batch {
-				scanDirectory(dir, true, jobs, stats) // Recurse into subdirectories
+				if ctx.Err() != nil {
+					break
+				}
+				scanDirectory(ctx, dir, true, jobs, stats) // Recurse into subdirectories
 				bar.Add(1)
 			}
 		}
 
-		bar.Finish()
+		if ctx.Err() == nil {
+			bar.Finish()
+		}
 		fmt.Println()
 
 		// Also scan files in the root directory itself
-		scanDirectory(rootDir, false, jobs, stats)
+		scanDirectory(ctx, rootDir, false, jobs, stats)
 
 	} else {
 		// Non-recursive: just scan the root directory
-		scanDirectory(rootDir, false, jobs, stats)
+		scanDirectory(ctx, rootDir, false, jobs, stats)
 	}
 }
 
@@ -111,10 +109,14 @@ func getSubdirectories(rootDir string) ([]string, error) {
 }
 
 // scanDirectory scans a single directory for supported file types
-func scanDirectory(dir string, recursive bool, jobs chan<- string, stats *Stats) {
+func scanDirectory(ctx context.Context, dir string, recursive bool, jobs chan<- string, stats *Stats) {
 	if recursive {
 		// Recursive scan using filepath.Walk
 		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return filepath.SkipAll
+			}
+
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: cannot access %s: %v\n", path, err)
 				return nil // Continue walking
@@ -126,8 +128,8 @@ func scanDirectory(dir string, recursive bool, jobs chan<- string, stats *Stats)
 			}
 
 			// Check if file has supported extension
-			if isSupportedFile(path) {
-				jobs <- path
+			if isSupportedFile(path) && !sendJob(ctx, jobs, path) {
+				return filepath.SkipAll
 			}
 
 			return nil
@@ -150,15 +152,29 @@ func scanDirectory(dir string, recursive bool, jobs chan<- string, stats *Stats)
 			}
 
 			filePath := filepath.Join(dir, entry.Name())
-			if isSupportedFile(filePath) {
-				jobs <- filePath
+			if isSupportedFile(filePath) && !sendJob(ctx, jobs, filePath) {
+				return
 			}
 		}
 	}
 }
 
-// isSupportedFile checks if a file has a supported extension
+// sendJob queues a file for the workers, returning false if ctx was
+// cancelled before the file could be queued
+func sendJob(ctx context.Context, jobs chan<- string, filePath string) bool {
+	select {
+	case jobs <- filePath:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isSupportedFile checks if a registered extractor handles the file's
+// extension. Download sidecars are JSON but never hold links to follow.
 func isSupportedFile(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	return supportedExtensions[ext]
+	if strings.HasSuffix(strings.ToLower(filePath), sidecarSuffix) {
+		return false
+	}
+	return extractors.forPath(filePath) != nil
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SegmentConfig is the JSON form of the segmented download settings in config.json
+type SegmentConfig struct {
+	Segments int    `json:"segments"` // parallel connections per file (1 or 0 = off)
+	MinSize  string `json:"min_size"` // only segment files at least this large
+}
+
+// segmentSettings holds the parsed SegmentConfig
+type segmentSettings struct {
+	segments        int
+	minSize         int64
+	maxConnsPerHost int // connections all downloads may hold per host (0 = unlimited)
+}
+
+// connectionCounts counts the connections held by in-flight downloads per
+// host, single streams and segments alike, so that segments only use the
+// part of max_connections_per_host that other downloads leave free
+type connectionCounts struct {
+	mu    sync.Mutex
+	inUse map[string]int
+}
+
+// hostConnections is shared by all workers
+var hostConnections = &connectionCounts{inUse: make(map[string]int)}
+
+// defaultSegmentMinSize keeps small files on a single connection
+const defaultSegmentMinSize = 64 << 20
+
+// segmentation is the active segmented download configuration, set at startup
+var segmentation = segmentSettings{segments: 1}
+
+// newSegmentSettings parses a SegmentConfig. maxConnsPerHost, when set, is
+// the per-host connection budget that segments are taken from.
+func newSegmentSettings(cfg SegmentConfig, maxConnsPerHost int) (segmentSettings, error) {
+	settings := segmentSettings{
+		segments:        max(cfg.Segments, 1),
+		minSize:         defaultSegmentMinSize,
+		maxConnsPerHost: maxConnsPerHost,
+	}
+
+	if cfg.MinSize != "" {
+		size, err := parseByteSize(cfg.MinSize)
+		if err != nil {
+			return settings, fmt.Errorf("segmented_downloads.min_size: %w", err)
+		}
+		settings.minSize = size
+	}
+
+	return settings, nil
+}
+
+// applies reports whether resp should be fetched in parallel segments: the
+// server must accept byte ranges and announce a large enough, unencoded body
+func (s segmentSettings) applies(resp *http.Response) bool {
+	return s.segments > 1 &&
+		resp.StatusCode == http.StatusOK &&
+		resp.ContentLength >= s.minSize &&
+		resp.ContentLength >= int64(s.segments) &&
+		strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") &&
+		resp.Header.Get("Content-Encoding") == "" &&
+		!resp.Uncompressed
+}
+
+// acquire counts the download of resp against its host's connections and
+// returns how many it may use: more than one to fetch resp in parallel
+// segments, taken from the connections other downloads from the host leave
+// free, or one to read it as a single stream. The connections must be given
+// back with release.
+func (s segmentSettings) acquire(resp *http.Response) int {
+	if s.maxConnsPerHost <= 0 {
+		if s.applies(resp) {
+			return s.segments
+		}
+		return 1
+	}
+
+	host := resp.Request.URL.Host
+	hostConnections.mu.Lock()
+	defer hostConnections.mu.Unlock()
+
+	connections := 1
+	if s.applies(resp) {
+		if free := s.maxConnsPerHost - hostConnections.inUse[host]; free >= 2 {
+			connections = min(s.segments, free)
+		}
+	}
+	hostConnections.inUse[host] += connections
+	return connections
+}
+
+// release gives back the connections counted by acquire
+func (s segmentSettings) release(resp *http.Response, connections int) {
+	if s.maxConnsPerHost <= 0 {
+		return
+	}
+
+	host := resp.Request.URL.Host
+	hostConnections.mu.Lock()
+	defer hostConnections.mu.Unlock()
+
+	hostConnections.inUse[host] -= connections
+	if hostConnections.inUse[host] <= 0 {
+		delete(hostConnections.inUse, host)
+	}
+}
+
+// downloadSegments writes resp's representation into outFile using parallel
+// range requests to the final URL, conditional on the representation being
+// unchanged. resp's own body is closed first so that it does not hold a
+// connection the segments wait for. outFile is preallocated to the full
+// length. Progress is not kept for resuming: like a single stream, a failed
+// segmented download is removed by the caller and restarts from byte 0.
+func downloadSegments(ctx context.Context, resp *http.Response, outFile *os.File, segments int) (int64, error) {
+	resp.Body.Close()
+
+	total := resp.ContentLength
+	if err := outFile.Truncate(total); err != nil {
+		return 0, fmt.Errorf("failed to preallocate file: %w", err)
+	}
+
+	// Abort all segments as soon as one fails
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	segmentSize := total / int64(segments)
+	written := make([]int64, segments)
+	var wg sync.WaitGroup
+
+	for i := 0; i < segments; i++ {
+		start := int64(i) * segmentSize
+		end := start + segmentSize - 1
+		if i == segments-1 {
+			end = total - 1
+		}
+
+		wg.Add(1)
+		go func(i int, start, end int64) {
+			defer wg.Done()
+
+			n, err := fetchSegment(ctx, resp, outFile, start, end)
+			written[i] = n
+			if err != nil {
+				cancel(fmt.Errorf("segment %d (bytes %d-%d): %w", i+1, start, end, err))
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	var bytesWritten int64
+	for _, n := range written {
+		bytesWritten += n
+	}
+
+	if err := context.Cause(ctx); err != nil {
+		return bytesWritten, err
+	}
+
+	// Verify the assembled length
+	if bytesWritten != total {
+		return bytesWritten, fmt.Errorf("segmented download incomplete: %d of %d bytes", bytesWritten, total)
+	}
+	if info, err := outFile.Stat(); err != nil || info.Size() != total {
+		return bytesWritten, fmt.Errorf("segmented download has wrong file size")
+	}
+
+	return bytesWritten, nil
+}
+
+// fetchSegment requests bytes start-end of resp's URL and writes them at
+// the same offset in outFile
+func fetchSegment(ctx context.Context, resp *http.Response, outFile *os.File, start, end int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resp.Request.URL.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	// Only accept the range if the representation has not changed
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		req.Header.Set("If-Range", etag)
+	} else if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Range", lastModified)
+	}
+
+	segResp, err := HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer segResp.Body.Close()
+
+	if segResp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("server answered range request with HTTP %d", segResp.StatusCode)
+	}
+	if got := segResp.Header.Get("Content-Range"); got != fmt.Sprintf("bytes %d-%d/%d", start, end, resp.ContentLength) {
+		return 0, fmt.Errorf("unexpected Content-Range %q", got)
+	}
+
+	return io.CopyN(io.NewOffsetWriter(outFile, start), segResp.Body, end-start+1)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// weblocExtractor reads macOS .webloc files, which are XML or binary
+// property lists with a URL key
+type weblocExtractor struct{}
+
+func (weblocExtractor) Name() string         { return "webloc" }
+func (weblocExtractor) Extensions() []string { return []string{".webloc"} }
+func (weblocExtractor) MIMETypes() []string  { return []string{"application/x-webloc"} }
+
+func (weblocExtractor) Extract(r io.Reader) ([]Link, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var webloc struct {
+		URL string `plist:"URL"`
+	}
+	if _, err := plist.Unmarshal(content, &webloc); err != nil {
+		return nil, fmt.Errorf("invalid property list: %w", err)
+	}
+
+	var links linkSet
+	links.add(webloc.URL, "")
+	return links.links, nil
+}
+
+// desktopExtractor reads freedesktop.org .desktop entries of Type=Link
+type desktopExtractor struct{}
+
+func (desktopExtractor) Name() string         { return "desktop" }
+func (desktopExtractor) Extensions() []string { return []string{".desktop"} }
+func (desktopExtractor) MIMETypes() []string  { return []string{"application/x-desktop"} }
+
+func (desktopExtractor) Extract(r io.Reader) ([]Link, error) {
+	var entryType, url, name string
+	inEntry := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Only the [Desktop Entry] group describes the link
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if !inEntry {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Type":
+			entryType = strings.TrimSpace(value)
+		case "URL":
+			url = unescapeDesktopValue(strings.TrimSpace(value))
+		case "URL[$e]":
+			// KDE marks values to be shell-expanded with [$e]
+			url = expandDesktopHome(unescapeDesktopValue(strings.TrimSpace(value)))
+		case "Name":
+			name = unescapeDesktopValue(strings.TrimSpace(value))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	// Applications and directories also use .desktop files
+	var links linkSet
+	if entryType == "Link" {
+		links.add(url, name)
+	}
+	return links.links, nil
+}
+
+// expandDesktopHome replaces a leading $HOME, ${HOME} or ~ in a [$e] value,
+// also after a file: scheme, with the user's home directory
+func expandDesktopHome(value string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+
+	scheme := ""
+	for _, prefix := range []string{"file://", "file:"} {
+		if strings.HasPrefix(value, prefix) {
+			scheme, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+
+	for _, variable := range []string{"${HOME}", "$HOME", "~"} {
+		rest, ok := strings.CutPrefix(value, variable)
+		if ok && (rest == "" || rest[0] == '/') {
+			return scheme + home + rest
+		}
+	}
+	return scheme + value
+}
+
+// unescapeDesktopValue decodes the \s, \n, \t, \r and \\ escapes of
+// .desktop string values
+func unescapeDesktopValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			buf.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 's':
+			buf.WriteByte(' ')
+		case 'n':
+			buf.WriteByte('\n')
+		case 't':
+			buf.WriteByte('\t')
+		case 'r':
+			buf.WriteByte('\r')
+		default:
+			buf.WriteByte(value[i])
+		}
+	}
+	return buf.String()
+}
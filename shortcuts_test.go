@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDesktopExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"link", "[Desktop Entry]\nType=Link\nURL=https://a.test/x\n", []string{"https://a.test/x"}},
+		{"shell-expanded key", "[Desktop Entry]\nType=Link\nURL[$e]=https://a.test/x\n", []string{"https://a.test/x"}},
+		{"application", "[Desktop Entry]\nType=Application\nURL=https://a.test/x\n", nil},
+		{"other group", "[Desktop Action x]\nType=Link\nURL=https://a.test/x\n", nil},
+		{"escaped", "[Desktop Entry]\nType=Link\nURL=https://a.test/a\\sb\n", []string{"https://a.test/a b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := desktopExtractor{}.Extract(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, link := range links {
+				got = append(got, link.URL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Extract(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandDesktopHome(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"$HOME/Downloads", "/home/user/Downloads"},
+		{"${HOME}/Downloads", "/home/user/Downloads"},
+		{"~/Downloads", "/home/user/Downloads"},
+		{"~", "/home/user"},
+		{"file:$HOME/a.zip", "file:/home/user/a.zip"},
+		{"file://$HOME/a.zip", "file:///home/user/a.zip"},
+		{"~other/x", "~other/x"},
+		{"$HOMEDIR/x", "$HOMEDIR/x"},
+		{"https://a.test/~user", "https://a.test/~user"},
+	}
+
+	for _, tt := range tests {
+		if got := expandDesktopHome(tt.value); got != tt.want {
+			t.Errorf("expandDesktopHome(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StructuredConfig is the JSON form of the structured data settings in
+// config.json
+type StructuredConfig struct {
+	CSV   CSVConfig      `json:"csv"`
+	JSON  SelectorConfig `json:"json"`
+	YAML  SelectorConfig `json:"yaml"`
+	Feeds FeedConfig     `json:"feeds"`
+}
+
+// CSVConfig selects the columns of CSV and TSV files by header
+type CSVConfig struct {
+	URLColumn   string `json:"url_column"`   // column holding the links; CSV and TSV files are ignored without it
+	TitleColumn string `json:"title_column"` // column holding link titles; default "title"
+}
+
+// SelectorConfig selects the links in JSON or YAML documents
+type SelectorConfig struct {
+	URLs       string `json:"urls"`        // JSONPath-like selector, e.g. "$.items[*].url"; files are ignored without it
+	TitleField string `json:"title_field"` // key next to a selected URL holding its title; default "title"
+}
+
+// FeedConfig controls which links of RSS and Atom feeds are taken
+type FeedConfig struct {
+	EnclosuresOnly bool `json:"enclosures_only"` // only media enclosures, e.g. podcast episodes
+}
+
+// structuredSettings is the parsed structured data configuration
+type structuredSettings struct {
+	csv   CSVConfig
+	json  selectorSettings
+	yaml  selectorSettings
+	feeds FeedConfig
+}
+
+// selectorSettings is a parsed SelectorConfig
+type selectorSettings struct {
+	steps      []selectorStep // nil leaves the extractor disabled
+	titleField string
+}
+
+// structured is the active structured data configuration, set at startup
+var structured = structuredSettings{
+	csv:  CSVConfig{TitleColumn: "title"},
+	json: selectorSettings{titleField: "title"},
+	yaml: selectorSettings{titleField: "title"},
+}
+
+// newStructuredSettings validates cfg and parses its selectors
+func newStructuredSettings(cfg StructuredConfig) (structuredSettings, error) {
+	settings := structuredSettings{csv: cfg.CSV, feeds: cfg.Feeds}
+	if settings.csv.TitleColumn == "" {
+		settings.csv.TitleColumn = "title"
+	}
+
+	var err error
+	if settings.json, err = newSelectorSettings(cfg.JSON); err != nil {
+		return structuredSettings{}, fmt.Errorf("structured.json: %w", err)
+	}
+	if settings.yaml, err = newSelectorSettings(cfg.YAML); err != nil {
+		return structuredSettings{}, fmt.Errorf("structured.yaml: %w", err)
+	}
+	return settings, nil
+}
+
+// newSelectorSettings parses a SelectorConfig
+func newSelectorSettings(cfg SelectorConfig) (selectorSettings, error) {
+	settings := selectorSettings{titleField: cfg.TitleField}
+	if settings.titleField == "" {
+		settings.titleField = "title"
+	}
+	if strings.TrimSpace(cfg.URLs) != "" {
+		steps, err := parseSelector(cfg.URLs)
+		if err != nil {
+			return selectorSettings{}, err
+		}
+		settings.steps = steps
+	}
+	return settings, nil
+}
+
+// csvExtractor reads CSV and TSV spreadsheets, whose first row is a header.
+// It is enabled by configuring the column holding the links.
+type csvExtractor struct{}
+
+func (csvExtractor) Name() string         { return "csv" }
+func (csvExtractor) Extensions() []string { return []string{".csv", ".tsv"} }
+func (csvExtractor) MIMETypes() []string  { return []string{"text/csv", "text/tab-separated-values"} }
+func (csvExtractor) Enabled() bool        { return structured.csv.URLColumn != "" }
+
+func (csvExtractor) Extract(r io.Reader) ([]Link, error) {
+	buffered := bufio.NewReader(r)
+	firstLine, _ := buffered.Peek(4096)
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = sniffDelimiter(firstLine)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	urlColumn := csvColumn(header, structured.csv.URLColumn)
+	if urlColumn < 0 {
+		return nil, fmt.Errorf("no column %q in header", structured.csv.URLColumn)
+	}
+	titleColumn := csvColumn(header, structured.csv.TitleColumn)
+
+	var links linkSet
+	record, err := reader.Read()
+	for ; err == nil; record, err = reader.Read() {
+		links.add(csvCell(record, urlColumn), csvCell(record, titleColumn))
+	}
+	if err != io.EOF {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	return links.links, nil
+}
+
+// sniffDelimiter picks the most common of tab, semicolon and comma in the
+// first line, defaulting to comma
+func sniffDelimiter(sample []byte) rune {
+	if i := bytes.IndexByte(sample, '\n'); i >= 0 {
+		sample = sample[:i]
+	}
+
+	delimiter, best := ',', bytes.Count(sample, []byte(","))
+	for _, candidate := range []rune{'\t', ';'} {
+		if n := bytes.Count(sample, []byte(string(candidate))); n > best {
+			delimiter, best = candidate, n
+		}
+	}
+	return delimiter
+}
+
+// csvCell returns the trimmed cell in column, or "" if the row is short
+func csvCell(record []string, column int) string {
+	if column < 0 || column >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[column])
+}
+
+// csvColumn returns the index of the column named name, ignoring case, or -1
+func csvColumn(header []string, name string) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonExtractor reads JSON documents, including JSON Lines. It is enabled
+// by configuring a selector for the links.
+type jsonExtractor struct{}
+
+func (jsonExtractor) Name() string         { return "json" }
+func (jsonExtractor) Extensions() []string { return []string{".json"} }
+func (jsonExtractor) MIMETypes() []string  { return []string{"application/json"} }
+func (jsonExtractor) Enabled() bool        { return structured.json.steps != nil }
+
+func (jsonExtractor) Extract(r io.Reader) ([]Link, error) {
+	var links linkSet
+	decoder := json.NewDecoder(r)
+	for {
+		var document any
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		addSelectedLinks(&links, document, structured.json)
+	}
+	return links.links, nil
+}
+
+// yamlExtractor reads YAML documents, including multi-document streams. It
+// is enabled by configuring a selector for the links.
+type yamlExtractor struct{}
+
+func (yamlExtractor) Name() string         { return "yaml" }
+func (yamlExtractor) Extensions() []string { return []string{".yaml", ".yml"} }
+func (yamlExtractor) MIMETypes() []string  { return []string{"application/yaml", "text/yaml"} }
+func (yamlExtractor) Enabled() bool        { return structured.yaml.steps != nil }
+
+func (yamlExtractor) Extract(r io.Reader) ([]Link, error) {
+	var links linkSet
+	decoder := yaml.NewDecoder(r)
+	for {
+		var document any
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		addSelectedLinks(&links, normalizeYAML(document), structured.yaml)
+	}
+	return links.links, nil
+}
+
+// normalizeYAML converts maps with non-string keys, which YAML allows, to
+// the map[string]any that JSON documents decode to
+func normalizeYAML(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = normalizeYAML(child)
+		}
+		return v
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, child := range v {
+			converted[fmt.Sprint(key)] = normalizeYAML(child)
+		}
+		return converted
+	case []any:
+		for i, child := range v {
+			v[i] = normalizeYAML(child)
+		}
+		return v
+	}
+	return value
+}
+
+// selectedValue is a value found by a selector, with the object holding it
+type selectedValue struct {
+	value  any
+	parent map[string]any
+}
+
+// addSelectedLinks adds the links selected in document, each titled by the
+// title field of the object holding it
+func addSelectedLinks(links *linkSet, document any, settings selectorSettings) {
+	for _, selected := range selectValues(document, settings.steps) {
+		title := ""
+		if selected.parent != nil {
+			title, _ = selected.parent[settings.titleField].(string)
+		}
+
+		switch v := selected.value.(type) {
+		case string:
+			addStructuredValue(links, v, strings.TrimSpace(title))
+		case []any:
+			// A selector may stop at a list of URLs
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					addStructuredValue(links, s, strings.TrimSpace(title))
+				}
+			}
+		}
+	}
+}
+
+// addStructuredValue adds a field that is a URL with title, or otherwise the
+// plain URLs in its text
+func addStructuredValue(links *linkSet, value, title string) {
+	value = strings.TrimSpace(value)
+	if isValidURL(value) {
+		links.add(value, title)
+		return
+	}
+	links.addText(value)
+}
+
+// selectorStep is one step of a selector such as "$.items[*].url"
+type selectorStep struct {
+	recursive bool   // ".." also matches at every depth below
+	key       string // object key, or "" for an array index or wildcard
+	index     int    // array index, when key is "" and wildcard is false
+	wildcard  bool   // every member or element
+}
+
+// parseSelector parses a JSONPath-like selector. It supports $, .key,
+// ['key'], [n], [*], .* and recursive descent with "..".
+func parseSelector(selector string) ([]selectorStep, error) {
+	s := strings.TrimSpace(selector)
+	s = strings.TrimPrefix(s, "$")
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s
+	}
+
+	var steps []selectorStep
+	for s != "" {
+		var step selectorStep
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case s[0] == '.':
+			s = strings.TrimPrefix(s, ".")
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if name == "" {
+				return nil, fmt.Errorf("invalid selector %q: empty key", selector)
+			}
+			if name == "*" {
+				step.wildcard = true
+			} else {
+				step.key = name
+			}
+			steps = append(steps, step)
+			continue
+		}
+
+		// Bracket step: [*], [n], ['key'] or ["key"]
+		end := strings.IndexByte(s, ']')
+		if !strings.HasPrefix(s, "[") || end < 0 {
+			return nil, fmt.Errorf("invalid selector %q at %q", selector, s)
+		}
+		inner := strings.TrimSpace(s[1:end])
+		s = s[end+1:]
+
+		switch {
+		case inner == "*":
+			step.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.key = inner[1 : len(inner)-1]
+			if step.key == "" {
+				return nil, fmt.Errorf("invalid selector %q: empty key", selector)
+			}
+		default:
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid selector %q: bad index %q", selector, inner)
+			}
+			step.index = index
+		}
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("invalid selector %q: selects the whole document", selector)
+	}
+	return steps, nil
+}
+
+// selectValues applies steps to document
+func selectValues(document any, steps []selectorStep) []selectedValue {
+	values := []selectedValue{{value: document}}
+	for _, step := range steps {
+		var next []selectedValue
+		for _, current := range values {
+			candidates := []selectedValue{current}
+			if step.recursive {
+				candidates = descendants(current)
+			}
+			for _, candidate := range candidates {
+				next = append(next, step.apply(candidate.value)...)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// apply returns the children of value matched by the step
+func (step selectorStep) apply(value any) []selectedValue {
+	switch v := value.(type) {
+	case map[string]any:
+		if step.wildcard {
+			var children []selectedValue
+			for _, key := range sortedKeys(v) {
+				children = append(children, selectedValue{v[key], v})
+			}
+			return children
+		}
+		if child, ok := v[step.key]; ok && step.key != "" {
+			return []selectedValue{{child, v}}
+		}
+	case []any:
+		if step.wildcard {
+			children := make([]selectedValue, len(v))
+			for i, child := range v {
+				children[i] = selectedValue{value: child}
+			}
+			return children
+		}
+		if step.key == "" && step.index < len(v) {
+			return []selectedValue{{value: v[step.index]}}
+		}
+	}
+	return nil
+}
+
+// descendants returns value and everything below it, in document order for
+// arrays and key order for objects
+func descendants(value selectedValue) []selectedValue {
+	all := []selectedValue{value}
+	switch v := value.value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			all = append(all, descendants(selectedValue{v[key], v})...)
+		}
+	case []any:
+		for _, child := range v {
+			all = append(all, descendants(selectedValue{value: child})...)
+		}
+	}
+	return all
+}
+
+// sortedKeys returns the keys of m in order, for a stable link order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// opmlExtractor reads OPML outlines such as feed reader subscription lists
+type opmlExtractor struct{}
+
+func (opmlExtractor) Name() string         { return "opml" }
+func (opmlExtractor) Extensions() []string { return []string{".opml"} }
+func (opmlExtractor) MIMETypes() []string  { return []string{"text/x-opml"} }
+
+func (opmlExtractor) Extract(r io.Reader) ([]Link, error) {
+	var links linkSet
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OPML: %w", err)
+		}
+
+		// Feeds have xmlUrl; plain link outlines have url
+		outline, ok := token.(xml.StartElement)
+		if !ok || outline.Name.Local != "outline" {
+			continue
+		}
+		title := xmlAttr(outline, "title")
+		if title == "" {
+			title = xmlAttr(outline, "text")
+		}
+		links.add(xmlAttr(outline, "xmlUrl"), strings.TrimSpace(title))
+		links.add(xmlAttr(outline, "url"), strings.TrimSpace(title))
+	}
+	return links.links, nil
+}
+
+// mediaRSSNamespace is the namespace of Media RSS elements such as
+// <media:content url="...">
+const mediaRSSNamespace = "http://search.yahoo.com/mrss/"
+
+// feedExtractor reads RSS and Atom feeds. Each item's enclosures come
+// before its link, all titled by the item.
+type feedExtractor struct{}
+
+func (feedExtractor) Name() string         { return "feed" }
+func (feedExtractor) Extensions() []string { return []string{".rss", ".atom"} }
+func (feedExtractor) MIMETypes() []string {
+	return []string{"application/rss+xml", "application/atom+xml"}
+}
+
+func (feedExtractor) Extract(r io.Reader) ([]Link, error) {
+	var links linkSet
+	var title, itemLink strings.Builder
+	var enclosures, alternates []string
+	inItem, inTitle, inLink, hasTitle := false, false, false, false
+
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid feed: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if name == "item" || name == "entry" {
+				inItem, hasTitle = true, false
+				title.Reset()
+				itemLink.Reset()
+				enclosures, alternates = nil, nil
+				continue
+			}
+			if !inItem {
+				continue
+			}
+			switch {
+			case name == "title" && !hasTitle && t.Name.Space != mediaRSSNamespace:
+				inTitle = true
+			case name == "enclosure":
+				enclosures = append(enclosures, xmlAttr(t, "url"))
+			case name == "content" && t.Name.Space == mediaRSSNamespace:
+				enclosures = append(enclosures, xmlAttr(t, "url"))
+			case name == "link":
+				// Atom links carry href and rel; RSS links are text
+				if href := xmlAttr(t, "href"); href != "" {
+					switch xmlAttr(t, "rel") {
+					case "enclosure":
+						enclosures = append(enclosures, href)
+					case "", "alternate":
+						alternates = append(alternates, href)
+					}
+				} else {
+					inLink = true
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "item", "entry":
+				if !inItem {
+					continue
+				}
+				itemTitle := strings.Join(strings.Fields(title.String()), " ")
+				for _, url := range enclosures {
+					links.add(url, itemTitle)
+				}
+				if !structured.feeds.EnclosuresOnly {
+					links.add(itemLink.String(), itemTitle)
+					for _, url := range alternates {
+						links.add(url, itemTitle)
+					}
+				}
+				inItem = false
+			case "title":
+				if inTitle {
+					inTitle, hasTitle = false, true
+				}
+			case "link":
+				inLink = false
+			}
+		case xml.CharData:
+			if inTitle {
+				title.Write(t)
+			}
+			if inLink {
+				itemLink.Write(bytes.TrimSpace(t))
+			}
+		}
+	}
+	return links.links, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TLSConfig is the JSON form of the TLS settings in config.json
+type TLSConfig struct {
+	MinVersion string          `json:"min_version"` // "1.0" to "1.3"; default 1.2
+	Hosts      []TLSHostConfig `json:"hosts"`
+}
+
+// TLSHostConfig customises TLS for hosts matching any of Hosts
+type TLSHostConfig struct {
+	Hosts              []string `json:"hosts"`
+	CAFile             string   `json:"ca_file"`     // extra PEM CA bundle, trusted in addition to the system roots
+	ClientCert         string   `json:"client_cert"` // PEM client certificate for mTLS
+	ClientKey          string   `json:"client_key"`  // PEM private key for ClientCert
+	MinVersion         string   `json:"min_version"`
+	Pins               []string `json:"pins"` // SPKI pins as "sha256/<base64>"
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+}
+
+// tlsHostRule is a parsed TLSHostConfig
+type tlsHostRule struct {
+	hosts  []string
+	config *tls.Config
+}
+
+// tlsSettings holds the default TLS configuration and per-host overrides
+type tlsSettings struct {
+	defaultConfig *tls.Config
+	rules         []tlsHostRule
+}
+
+// insecureHostsLogged records hosts already warned about, so the per-connection
+// warning for insecure_skip_verify is printed once per host
+var insecureHostsLogged sync.Map
+
+// newTLSSettings parses a TLSConfig, loading CA bundles and client certificates
+func newTLSSettings(cfg TLSConfig) (*tlsSettings, error) {
+	minVersion, err := parseTLSVersion(cfg.MinVersion, tls.VersionTLS12)
+	if err != nil {
+		return nil, fmt.Errorf("tls.min_version: %w", err)
+	}
+
+	settings := &tlsSettings{
+		defaultConfig: &tls.Config{MinVersion: minVersion},
+	}
+
+	for i, hostCfg := range cfg.Hosts {
+		if len(hostCfg.Hosts) == 0 {
+			return nil, fmt.Errorf("tls.hosts[%d]: no hosts given", i)
+		}
+
+		hosts := normalizeList(hostCfg.Hosts, false)
+		config, err := newHostTLSConfig(hostCfg, hosts, minVersion)
+		if err != nil {
+			return nil, fmt.Errorf("tls.hosts[%d]: %w", i, err)
+		}
+
+		if hostCfg.InsecureSkipVerify {
+			fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification is DISABLED for %s\n", strings.Join(hosts, ", "))
+		}
+
+		settings.rules = append(settings.rules, tlsHostRule{hosts: hosts, config: config})
+	}
+
+	return settings, nil
+}
+
+// newHostTLSConfig builds the tls.Config for one TLSHostConfig
+func newHostTLSConfig(hostCfg TLSHostConfig, hosts []string, defaultMinVersion uint16) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(hostCfg.MinVersion, defaultMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("min_version: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:         minVersion,
+		InsecureSkipVerify: hostCfg.InsecureSkipVerify,
+	}
+
+	// Trust the extra CA bundle in addition to the system roots
+	if hostCfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(hostCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s: no PEM certificates found", hostCfg.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	// Present a client certificate for mutual TLS
+	if hostCfg.ClientCert != "" || hostCfg.ClientKey != "" {
+		if hostCfg.ClientCert == "" || hostCfg.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(hostCfg.ClientCert, hostCfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	pins, err := parseSPKIPins(hostCfg.Pins)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pins) > 0 || hostCfg.InsecureSkipVerify {
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			// IP address hosts have no SNI server name
+			serverName := cs.ServerName
+			if serverName == "" {
+				serverName = strings.Join(hosts, ", ")
+			}
+
+			if hostCfg.InsecureSkipVerify {
+				if _, logged := insecureHostsLogged.LoadOrStore(serverName, true); !logged {
+					fmt.Fprintf(os.Stderr, "WARNING: connected to %s WITHOUT verifying its TLS certificate\n", serverName)
+				}
+			}
+			if len(pins) > 0 {
+				return verifySPKIPins(serverName, cs, pins)
+			}
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// parseTLSVersion converts "1.0" to "1.3" into a tls.Version constant
+func parseTLSVersion(version string, defaultVersion uint16) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "":
+		return defaultVersion, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q", version)
+	}
+}
+
+// parseSPKIPins decodes pins of the form "sha256/<base64>"
+func parseSPKIPins(pins []string) ([][]byte, error) {
+	var decoded [][]byte
+	for _, pin := range pins {
+		encoded, ok := strings.CutPrefix(strings.TrimSpace(pin), "sha256/")
+		if !ok {
+			return nil, fmt.Errorf("pin %q must start with sha256/", pin)
+		}
+		hash, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("pin %q is not a base64 SHA-256 hash", pin)
+		}
+		decoded = append(decoded, hash)
+	}
+	return decoded, nil
+}
+
+// verifySPKIPins succeeds if any certificate presented by the server has a
+// public key matching one of the pins
+func verifySPKIPins(serverName string, cs tls.ConnectionState, pins [][]byte) error {
+	for _, cert := range cs.PeerCertificates {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if string(hash[:]) == string(pin) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("TLS public key pin mismatch for %s", serverName)
+}
+
+// tlsRouter sends each request through the transport whose TLS settings
+// match the request's host
+type tlsRouter struct {
+	hosts      [][]string
+	transports []*http.Transport
+	fallback   *http.Transport
+}
+
+// newTLSRouter clones base once per TLS host rule
+func newTLSRouter(base *http.Transport, settings *tlsSettings) *tlsRouter {
+	base.TLSClientConfig = settings.defaultConfig.Clone()
+	router := &tlsRouter{fallback: base}
+
+	for _, rule := range settings.rules {
+		transport := base.Clone()
+		transport.TLSClientConfig = rule.config.Clone()
+		router.hosts = append(router.hosts, rule.hosts)
+		router.transports = append(router.transports, transport)
+	}
+
+	return router
+}
+
+func (r *tlsRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for i, patterns := range r.hosts {
+		if matchAnyHost(patterns, host) {
+			return r.transports[i].RoundTrip(req)
+		}
+	}
+	return r.fallback.RoundTrip(req)
+}
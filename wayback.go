@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// WaybackConfig is the JSON form of the Wayback Machine fallback settings
+type WaybackConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Endpoint string `json:"endpoint"` // availability API (default: archive.org)
+}
+
+// waybackSettings holds the parsed WaybackConfig
+type waybackSettings struct {
+	enabled  bool
+	endpoint *url.URL
+}
+
+// defaultWaybackEndpoint is the Wayback Machine availability API
+const defaultWaybackEndpoint = "https://archive.org/wayback/available"
+
+// wayback is the active fallback configuration, set at startup
+var wayback waybackSettings
+
+// newWaybackSettings parses a WaybackConfig
+func newWaybackSettings(cfg WaybackConfig) (waybackSettings, error) {
+	settings := waybackSettings{enabled: cfg.Enabled}
+
+	endpoint := strings.TrimSpace(cfg.Endpoint)
+	if endpoint == "" {
+		endpoint = defaultWaybackEndpoint
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return settings, fmt.Errorf("wayback.endpoint: invalid URL %q", cfg.Endpoint)
+	}
+	settings.endpoint = parsed
+
+	return settings, nil
+}
+
+// waybackTimestampPattern matches the timestamp segment of a snapshot URL
+var waybackTimestampPattern = regexp.MustCompile(`/web/(\d{14})/`)
+
+// waybackAvailability is the response of the availability API
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// isDeadLink reports whether a failed request means the link itself is
+// gone: HTTP 404/410 or a failed DNS lookup
+func isDeadLink(resp *http.Response, err error) bool {
+	if err != nil {
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr)
+	}
+	return resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+}
+
+// findWaybackSnapshot asks the availability API for the snapshot closest to
+// now, returning the raw-content snapshot URL and its timestamp
+func findWaybackSnapshot(ctx context.Context, originalURL string) (string, time.Time, error) {
+	endpoint := *wayback.endpoint
+	query := endpoint.Query()
+	query.Set("url", originalURL)
+	endpoint.RawQuery = query.Encode()
+
+	resp, err := waybackGet(ctx, endpoint.String())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("wayback lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("wayback lookup failed: HTTP %d", resp.StatusCode)
+	}
+
+	var availability waybackAvailability
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		return "", time.Time{}, fmt.Errorf("wayback lookup failed: %w", err)
+	}
+
+	closest := availability.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.Status != "200" {
+		return "", time.Time{}, fmt.Errorf("no archived snapshot available")
+	}
+
+	timestamp, err := time.Parse("20060102150405", closest.Timestamp)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid snapshot timestamp %q", closest.Timestamp)
+	}
+
+	// Request the original bytes rather than the page with the archive toolbar
+	snapshotURL := waybackTimestampPattern.ReplaceAllString(closest.URL, "/web/${1}id_/")
+
+	return snapshotURL, timestamp, nil
+}
+
+// waybackGet performs a GET request to the availability API or a snapshot.
+// The configured endpoint's host is reachable even where the network policy
+// denies it, e.g. a local stand-in; its connections are closed after each
+// response so that links to the same host cannot reuse them.
+func waybackGet(ctx context.Context, urlStr string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(withTrustedEndpoint(ctx, wayback.endpoint), http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Close = true
+	return HTTPClient.Do(req)
+}
+
+// recoverFromWayback downloads the closest archived snapshot of a dead link
+// to filePath and reports whether it was saved. A snapshot that is saved,
+// filtered or skipped replaces result; if none could be fetched or saved,
+// result keeps its error with the reason added.
+func recoverFromWayback(ctx context.Context, originalURL, filePath string, filter DownloadFilter, result *DownloadResult) bool {
+	snapshotURL, timestamp, err := findWaybackSnapshot(ctx, originalURL)
+	if err != nil {
+		result.Error = fmt.Errorf("%w (wayback: %v)", result.Error, err)
+		return false
+	}
+
+	resp, err := waybackGet(ctx, snapshotURL)
+	if err != nil {
+		result.Error = fmt.Errorf("%w (wayback snapshot failed: %v)", result.Error, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Errorf("%w (wayback snapshot failed: HTTP %d)", result.Error, resp.StatusCode)
+		return false
+	}
+
+	recovered := DownloadResult{
+		URL:                  result.URL,
+		FilePath:             filePath,
+		RecoveredFromArchive: true,
+		ArchiveURL:           snapshotURL,
+		ArchiveTimestamp:     timestamp,
+	}
+	recordRedirects(resp, &recovered)
+	saveResponse(ctx, resp, filePath, filter, &recovered)
+	if !recovered.Success && !recovered.Filtered && !recovered.Skipped {
+		result.Error = fmt.Errorf("%w (wayback snapshot failed: %v)", result.Error, recovered.Error)
+		return false
+	}
+
+	*result = recovered
+	return recovered.Success
+}
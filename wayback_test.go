@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWaybackFallbackLocalEndpoint recovers a dead link from a stand-in
+// availability API on loopback, which the default network policy denies
+// for links but allows for the configured endpoint
+func TestWaybackFallbackLocalEndpoint(t *testing.T) {
+	const content = "archived report"
+
+	var standIn *httptest.Server
+	standIn = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/wayback/available":
+			fmt.Fprintf(w, `{"archived_snapshots":{"closest":{"available":true,"status":"200","timestamp":"20190614082251","url":"%s/web/20190614082251/%s"}}}`,
+				standIn.URL, r.URL.Query().Get("url"))
+		case strings.HasPrefix(r.URL.Path, "/web/20190614082251id_/"):
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer standIn.Close()
+
+	policy, err := newNetworkPolicy(NetworkConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := newWaybackSettings(WaybackConfig{Enabled: true, Endpoint: standIn.URL + "/wayback/available"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedClient, savedWayback := HTTPClient, wayback
+	defer func() { HTTPClient, wayback = savedClient, savedWayback }()
+	HTTPClient = newHTTPClient(ClientOptions{Timeouts: Timeouts{Connect: 5 * time.Second}, Network: policy})
+	wayback = settings
+
+	// .invalid names never resolve, so the link is dead
+	dir := t.TempDir()
+	result := downloadURL(context.Background(), Link{URL: "http://files.invalid/report.pdf"}, dir, DownloadFilter{})
+	if !result.Success || !result.RecoveredFromArchive {
+		t.Fatalf("link not recovered: success=%v recovered=%v err=%v", result.Success, result.RecoveredFromArchive, result.Error)
+	}
+	if want := time.Date(2019, 6, 14, 8, 22, 51, 0, time.UTC); !result.ArchiveTimestamp.Equal(want) {
+		t.Errorf("snapshot timestamp = %v, want %v", result.ArchiveTimestamp, want)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "report.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("recovered content = %q, want %q", got, content)
+	}
+
+	// A link naming the endpoint's host is still subject to the policy
+	result = downloadURL(context.Background(), Link{URL: standIn.URL + "/web/20190614082251id_/x.pdf"}, dir, DownloadFilter{})
+	if result.Success || result.Error == nil || !strings.Contains(result.Error.Error(), "blocked by network policy") {
+		t.Errorf("direct link to the endpoint host: success=%v err=%v, want blocked by network policy", result.Success, result.Error)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	neturl "net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -15,53 +18,94 @@ type Result struct {
 	DownloadResults []DownloadResult
 }
 
-// worker processes files from the jobs channel
-func worker(id int, jobs <-chan string, results chan<- Result, wg *sync.WaitGroup) {
+// worker processes files from the jobs channel until it is closed.
+// Once ctx is cancelled, remaining queued files are drained without processing.
+func worker(ctx context.Context, id int, jobs <-chan string, results chan<- Result, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for filePath := range jobs {
-		result := processFile(id, filePath)
+		if ctx.Err() != nil {
+			continue
+		}
+		result := processFile(ctx, id, filePath)
 		results <- result
 	}
 }
 
 // processFile processes a single file and downloads all URLs found in it
-func processFile(workerID int, filePath string) Result {
+func processFile(ctx context.Context, workerID int, filePath string) Result {
 	result := Result{
 		FilePath: filePath,
 	}
 
-	// Extract URLs from file
-	urls, err := extractURLsFromFile(filePath)
+	// Extract links from file
+	links, err := extractLinksFromFile(filePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[Worker %d] ✗ Error reading %s: %v\n", workerID, filepath.Base(filePath), err)
+		fmt.Fprintf(os.Stderr, "[Worker %d] ✗ Error reading %s: %s\n", workerID, filepath.Base(filePath), redactError(err))
 		return result
 	}
 
-	result.URLsFound = len(urls)
+	result.URLsFound = len(links)
 
-	if len(urls) == 0 {
+	if len(links) == 0 {
 		// No URLs found, skip silently or print if verbose
 		return result
 	}
 
-	fmt.Printf("[Worker %d] Found %d URL(s) in %s\n", workerID, len(urls), filepath.Base(filePath))
+	fmt.Printf("[Worker %d] Found %d URL(s) in %s\n", workerID, len(links), filepath.Base(filePath))
 
-	// Get the directory of the source file
+	// Get the directory of the source file and the filters for its scan root
 	targetDir := filepath.Dir(filePath)
+	filter := downloadFilters.forPath(filePath)
 
 	// Download each URL
-	for _, url := range urls {
-		downloadResult := downloadURL(url, targetDir)
+	for _, link := range links {
+		if ctx.Err() != nil {
+			break
+		}
+
+		url := link.URL
+
+		// Bookmarks may be mirrored into subfolders of their folder path
+		linkDir, err := bookmarkDir(targetDir, link)
+		if err != nil {
+			result.DownloadResults = append(result.DownloadResults, DownloadResult{URL: url, Error: err})
+			fmt.Fprintf(os.Stderr, "[Worker %d] ✗ Failed: %s - %s\n", workerID, redact(url), redactError(err))
+			continue
+		}
+
+		downloadResult := downloadURL(ctx, link, linkDir, filter)
 		result.DownloadResults = append(result.DownloadResults, downloadResult)
 
+		// Report redirects that moved the link to another host
+		if movedHost := redirectedHost(url, downloadResult); movedHost != "" {
+			fmt.Printf("[Worker %d] ↪ Redirected: %s → %s (%d hop(s))\n", workerID, redact(url), redact(downloadResult.FinalURL), len(downloadResult.RedirectChain)-1)
+		}
+
 		// Print download result
-		if downloadResult.Success {
+		if downloadResult.Success && downloadResult.RecoveredFromArchive {
+			fmt.Printf("[Worker %d] ✓ Downloaded: %s (%s, recovered from archive, snapshot %s)\n", workerID, filepath.Base(downloadResult.FilePath),
+				formatBytes(downloadResult.BytesWritten), downloadResult.ArchiveTimestamp.Format("2006-01-02 15:04:05 UTC"))
+		} else if downloadResult.Success {
 			fmt.Printf("[Worker %d] ✓ Downloaded: %s (%s)\n", workerID, filepath.Base(downloadResult.FilePath), formatBytes(downloadResult.BytesWritten))
 		} else if downloadResult.Skipped {
-			fmt.Printf("[Worker %d] ⏭ Skipped: %s (already exists)\n", workerID, filepath.Base(downloadResult.FilePath))
+			fmt.Printf("[Worker %d] ⏭ Skipped: %s (%s)\n", workerID, skippedName(url, downloadResult), redactError(downloadResult.Error))
+		} else if downloadResult.Filtered {
+			fmt.Printf("[Worker %d] ⊘ Filtered: %s (%s)\n", workerID, redact(url), downloadResult.FilterReason)
 		} else {
-			fmt.Fprintf(os.Stderr, "[Worker %d] ✗ Failed: %s - %v\n", workerID, url, downloadResult.Error)
+			fmt.Fprintf(os.Stderr, "[Worker %d] ✗ Failed: %s - %s\n", workerID, redact(url), redactError(downloadResult.Error))
+		}
+
+		// Report a modification time the filesystem refused
+		if downloadResult.ModTimeError != nil {
+			fmt.Fprintf(os.Stderr, "[Worker %d] Warning: failed to set modification time of %s: %s\n", workerID, filepath.Base(downloadResult.FilePath), redactError(downloadResult.ModTimeError))
+		}
+
+		// Record where the file came from
+		if downloadResult.Success && (provenance.Sidecar || provenance.Xattr) {
+			if err := recordProvenance(filePath, link, downloadResult); err != nil {
+				fmt.Fprintf(os.Stderr, "[Worker %d] Warning: failed to record metadata for %s: %s\n", workerID, filepath.Base(downloadResult.FilePath), redactError(err))
+			}
 		}
 	}
 
@@ -83,11 +127,41 @@ func collectResults(results <-chan Result, stats *Stats, wg *sync.WaitGroup) {
 		for _, downloadResult := range result.DownloadResults {
 			if downloadResult.Success {
 				atomic.AddInt32(&stats.DownloadSuccess, 1)
+				if downloadResult.RecoveredFromArchive {
+					atomic.AddInt32(&stats.DownloadArchived, 1)
+				}
 			} else if downloadResult.Skipped {
 				atomic.AddInt32(&stats.DownloadSkipped, 1)
+			} else if downloadResult.Filtered {
+				atomic.AddInt32(&stats.DownloadFiltered, 1)
 			} else {
 				atomic.AddInt32(&stats.DownloadFailed, 1)
 			}
 		}
 	}
 }
+
+// skippedName returns the file name of a skipped download, or its URL when
+// it was skipped before a file name was chosen
+func skippedName(url string, result DownloadResult) string {
+	if result.FilePath == "" {
+		return redact(url)
+	}
+	return filepath.Base(result.FilePath)
+}
+
+// redirectedHost returns the final host of a download if redirects moved it
+// away from the host of the original link, or "" otherwise. Redirects within
+// the Wayback Machine are not reported for recovered links.
+func redirectedHost(link string, result DownloadResult) string {
+	if len(result.RedirectChain) == 0 || result.RecoveredFromArchive {
+		return ""
+	}
+
+	original, err1 := neturl.Parse(link)
+	final, err2 := neturl.Parse(result.FinalURL)
+	if err1 != nil || err2 != nil || strings.EqualFold(original.Hostname(), final.Hostname()) {
+		return ""
+	}
+	return final.Hostname()
+}
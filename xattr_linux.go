@@ -0,0 +1,11 @@
+//go:build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// setOriginURL records where path was downloaded from in the freedesktop.org
+// user.xdg.origin.url extended attribute
+func setOriginURL(path, originURL string) error {
+	return unix.Setxattr(path, "user.xdg.origin.url", []byte(originURL), 0)
+}
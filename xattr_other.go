@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// setOriginURL is not implemented on this platform; no attribute is set
+func setOriginURL(path, originURL string) error {
+	return errors.ErrUnsupported
+}